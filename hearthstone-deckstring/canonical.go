@@ -0,0 +1,82 @@
+package deckstring
+
+import "sort"
+
+// Cards returns every card in d with its total count, sorted by DBF ID. Cards listed
+// more than once, or in more than one section, are merged into a single entry.
+func (d Deck) Cards() []Card {
+	counts := make(map[uint64]uint64)
+	for _, id := range d.SingleCards {
+		counts[id]++
+	}
+	for _, id := range d.DoubleCards {
+		counts[id] += 2
+	}
+	for _, c := range d.NCards {
+		counts[c.DBF] += c.Count
+	}
+
+	cards := make([]Card, 0, len(counts))
+	for id, n := range counts {
+		if n > 0 {
+			cards = append(cards, Card{DBF: id, Count: n})
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].DBF < cards[j].DBF })
+	return cards
+}
+
+// Canonical returns a copy of d where each card is placed in the section matching its
+// total count and every section is sorted by DBF ID. Two decks containing the same cards
+// have identical canonical forms.
+func (d Deck) Canonical() Deck {
+	c := Deck{
+		Version:     d.Version,
+		Format:      d.Format,
+		Heroes:      append([]uint64{}, d.Heroes...),
+		SingleCards: []uint64{},
+		DoubleCards: []uint64{},
+		NCards:      []Card{},
+	}
+	for _, card := range d.Cards() {
+		switch card.Count {
+		case 1:
+			c.SingleCards = append(c.SingleCards, card.DBF)
+		case 2:
+			c.DoubleCards = append(c.DoubleCards, card.DBF)
+		default:
+			c.NCards = append(c.NCards, card)
+		}
+	}
+	c.Sideboards = canonicalSideboards(d.Sideboards)
+	return c
+}
+
+// canonicalSideboards merges duplicate sideboard cards and sorts them by owner then DBF ID.
+func canonicalSideboards(sideboards []SideboardCard) []SideboardCard {
+	type key struct{ owner, dbf uint64 }
+	counts := make(map[key]uint64)
+	for _, c := range sideboards {
+		counts[key{c.Owner, c.DBF}] += c.Count
+	}
+
+	var merged []SideboardCard
+	for k, n := range counts {
+		if n > 0 {
+			merged = append(merged, SideboardCard{Card: Card{DBF: k.dbf, Count: n}, Owner: k.owner})
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Owner != merged[j].Owner {
+			return merged[i].Owner < merged[j].Owner
+		}
+		return merged[i].DBF < merged[j].DBF
+	})
+	return merged
+}
+
+// Equal reports whether d and other describe the same deck, ignoring card order and
+// how cards are split between sections.
+func (d Deck) Equal(other Deck) bool {
+	return d.Encode() == other.Encode()
+}
@@ -0,0 +1,159 @@
+package deckstring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// CardInfo is a card's entry in a HearthstoneJSON cards.json file.
+type CardInfo struct {
+	DBF     uint64   `json:"dbfId"`
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Cost    int      `json:"cost"`
+	Class   string   `json:"cardClass"`
+	Classes []string `json:"classes,omitempty"`
+	Rarity  string   `json:"rarity"`
+	Set     string   `json:"set"`
+	Type    string   `json:"type"`
+}
+
+// Catalog resolves card DBF IDs to card information.
+type Catalog struct {
+	cards map[uint64]CardInfo
+}
+
+// LoadCatalog reads a HearthstoneJSON style cards.json file, see https://hearthstonejson.com.
+func LoadCatalog(filename string) (*Catalog, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCatalog(f)
+}
+
+// ReadCatalog reads a JSON array of cards from r.
+func ReadCatalog(r io.Reader) (*Catalog, error) {
+	var cards []CardInfo
+	if err := json.NewDecoder(r).Decode(&cards); err != nil {
+		return nil, fmt.Errorf("failed to decode cards: %v", err)
+	}
+	return NewCatalog(cards), nil
+}
+
+// NewCatalog creates a Catalog from cards, cards without a DBF ID are ignored.
+func NewCatalog(cards []CardInfo) *Catalog {
+	c := &Catalog{cards: make(map[uint64]CardInfo, len(cards))}
+	for _, card := range cards {
+		if card.DBF != 0 {
+			c.cards[card.DBF] = card
+		}
+	}
+	return c
+}
+
+// Card returns the card with the DBF ID dbf.
+func (c *Catalog) Card(dbf uint64) (CardInfo, bool) {
+	card, ok := c.cards[dbf]
+	return card, ok
+}
+
+// UnknownCardError is returned when a deck contains DBF IDs that are not in the Catalog.
+type UnknownCardError struct {
+	DBFs []uint64
+}
+
+func (e *UnknownCardError) Error() string {
+	return fmt.Sprintf("unknown card DBF IDs: %v", e.DBFs)
+}
+
+// DeckListCard is a resolved card and the number of copies of it in a deck.
+type DeckListCard struct {
+	CardInfo
+	Count uint64 `json:"count"`
+}
+
+// DeckList is a Deck with every DBF ID resolved against a Catalog.
+type DeckList struct {
+	Deck   Deck           `json:"deck"`
+	Heroes []CardInfo     `json:"heroes"`
+	Cards  []DeckListCard `json:"cards"`
+	// Sideboards maps the DBF ID of an owning card to the cards in its sideboard.
+	Sideboards map[uint64][]DeckListCard `json:"sideboards,omitempty"`
+}
+
+// Resolve looks up every card in d. If any DBF IDs are missing from the catalog an
+// *UnknownCardError listing all of them is returned.
+func (c *Catalog) Resolve(d Deck) (DeckList, error) {
+	var unknown []uint64
+	lookup := func(dbf uint64) CardInfo {
+		card, ok := c.cards[dbf]
+		if !ok {
+			unknown = append(unknown, dbf)
+		}
+		return card
+	}
+
+	d = d.Canonical()
+	dl := DeckList{Deck: d}
+	for _, h := range d.Heroes {
+		dl.Heroes = append(dl.Heroes, lookup(h))
+	}
+	for _, card := range d.Cards() {
+		dl.Cards = append(dl.Cards, DeckListCard{CardInfo: lookup(card.DBF), Count: card.Count})
+	}
+	for _, card := range d.Sideboards {
+		if dl.Sideboards == nil {
+			dl.Sideboards = make(map[uint64][]DeckListCard)
+		}
+		dl.Sideboards[card.Owner] = append(dl.Sideboards[card.Owner], DeckListCard{CardInfo: lookup(card.DBF), Count: card.Count})
+	}
+
+	if len(unknown) > 0 {
+		return DeckList{}, &UnknownCardError{DBFs: unknown}
+	}
+
+	sortDeckListCards(dl.Cards)
+	for _, cards := range dl.Sideboards {
+		sortDeckListCards(cards)
+	}
+	return dl, nil
+}
+
+// sortDeckListCards sorts cards by mana cost then name, the order used in game.
+func sortDeckListCards(cards []DeckListCard) {
+	sort.Slice(cards, func(i, j int) bool {
+		if cards[i].Cost != cards[j].Cost {
+			return cards[i].Cost < cards[j].Cost
+		}
+		return cards[i].Name < cards[j].Name
+	})
+}
+
+// Class returns the class of the deck's first hero.
+func (dl DeckList) Class() string {
+	if len(dl.Heroes) == 0 {
+		return ""
+	}
+	return dl.Heroes[0].Class
+}
+
+func (dl DeckList) String() string {
+	var sb strings.Builder
+	for _, h := range dl.Heroes {
+		sb.WriteString(fmt.Sprintf("hero: %s (%s)\n", h.Name, h.Class))
+	}
+	sb.WriteString(fmt.Sprintf("format: %s\n", dl.Deck.Format))
+	for _, c := range dl.Cards {
+		sb.WriteString(fmt.Sprintf("%dx (%d) %s\n", c.Count, c.Cost, c.Name))
+		for _, sc := range dl.Sideboards[c.DBF] {
+			sb.WriteString(fmt.Sprintf("  %dx (%d) %s\n", sc.Count, sc.Cost, sc.Name))
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
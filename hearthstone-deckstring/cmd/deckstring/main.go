@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	deckstring "github.com/1gm/x/hearthstone-deckstring"
+	"github.com/1gm/x/internal/log"
+	"go.uber.org/zap"
+)
+
+type options struct {
+	encode    bool
+	cardsFile string
+	validate  bool
+	setsFile  string
+	text      bool
+	diff      bool
+	stats     bool
+	turn      int
+	cluster   float64
+}
+
+func main() {
+	var opts options
+	flag.BoolVar(&opts.encode, "e", false, "encode a JSON deck read from stdin instead of decoding deckstrings")
+	flag.StringVar(&opts.cardsFile, "cards", "", "path to a HearthstoneJSON cards.json file, decoded decks are printed as card lists when set")
+	flag.BoolVar(&opts.validate, "validate", false, "print deck building rule violations for each decoded deck (requires -cards)")
+	flag.StringVar(&opts.setsFile, "sets", "", "path to a JSON file of the card sets legal in each format, needed by -validate for Standard and Twist decks")
+	flag.BoolVar(&opts.text, "text", false, "print decoded decks in the in-game copy/paste format (requires -cards)")
+	flag.BoolVar(&opts.stats, "stats", false, "print mana curve, card types and draw probabilities for each decoded deck (requires -cards)")
+	flag.IntVar(&opts.turn, "turn", 4, "turn used for the draw probabilities printed by -stats")
+	flag.BoolVar(&opts.diff, "diff", false, "print the changes from the first deckstring read from stdin to the second")
+	flag.Float64Var(&opts.cluster, "cluster", 0, "group the deckstrings read from stdin into archetypes with at least this similarity (0-1)")
+	flag.Parse()
+
+	os.Exit(realMain(os.Stdin, os.Stdout, opts))
+}
+
+func realMain(in io.Reader, out io.Writer, opts options) int {
+	log := log.New()
+	defer log.Sync()
+
+	var catalog *deckstring.Catalog
+	if opts.cardsFile != "" {
+		var err error
+		if catalog, err = deckstring.LoadCatalog(opts.cardsFile); err != nil {
+			log.Errorf("failed to load card catalog: %v", err)
+			return 1
+		}
+	} else if opts.validate || opts.text || opts.stats {
+		log.Error("-validate, -text and -stats require a card catalog, use -cards")
+		return 1
+	}
+
+	var validator *deckstring.Validator
+	if opts.validate {
+		validator = deckstring.NewValidator(catalog)
+		if opts.setsFile != "" {
+			sets, err := deckstring.LoadSets(opts.setsFile)
+			if err != nil {
+				log.Errorf("failed to load sets: %v", err)
+				return 1
+			}
+			for f, s := range sets {
+				validator.Sets[f] = s
+			}
+		}
+	}
+
+	switch {
+	case opts.encode:
+		var d deckstring.Deck
+		if err := json.NewDecoder(in).Decode(&d); err != nil {
+			log.Errorf("failed to decode deck JSON: %v", err)
+			return 1
+		}
+		if d.Version == 0 {
+			d.Version = deckstring.Version
+		}
+		fmt.Fprintln(out, d.Encode())
+		return 0
+	case opts.diff:
+		return diff(log, in, out, catalog)
+	case opts.cluster > 0:
+		return cluster(log, in, out, opts.cluster)
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	err := scanDeckstrings(in, func(line string) error {
+		d, err := deckstring.Decode(line)
+		if err != nil {
+			return fmt.Errorf("failed to decode %q: %v", line, err)
+		}
+		if catalog == nil {
+			return enc.Encode(d)
+		}
+
+		dl, err := catalog.Resolve(d)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %q: %v", line, err)
+		}
+		if opts.text {
+			fmt.Fprint(out, dl.Text(""))
+		} else {
+			fmt.Fprintf(out, "%s\n", dl)
+		}
+		if validator != nil {
+			violations, err := validator.Validate(d)
+			var rotationErr *deckstring.RotationError
+			if errors.As(err, &rotationErr) {
+				return fmt.Errorf("failed to validate %q: %v, use -sets", line, err)
+			} else if err != nil {
+				return fmt.Errorf("failed to validate %q: %v", line, err)
+			}
+			for _, v := range violations {
+				fmt.Fprintln(out, "invalid:", v)
+			}
+		}
+		if opts.stats {
+			fmt.Fprintln(out, dl.Stats())
+			fmt.Fprintf(out, "drawn by turn %d (play / coin):\n", opts.turn)
+			for _, c := range dl.Cards {
+				fmt.Fprintf(out, "  %5.1f%% / %5.1f%%  %s\n", 100*dl.DrawAny(opts.turn, false, c.DBF), 100*dl.DrawAny(opts.turn, true, c.DBF), c.Name)
+			}
+		}
+		fmt.Fprintln(out)
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	return 0
+}
+
+// scanDeckstrings calls fn with each non-empty line of in, comment lines from the
+// in-game copy/paste format are skipped.
+func scanDeckstrings(in io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read input: %v", err)
+	}
+	return nil
+}
+
+func readDecks(in io.Reader) (lines []string, decks []deckstring.Deck, err error) {
+	err = scanDeckstrings(in, func(line string) error {
+		d, err := deckstring.Decode(line)
+		if err != nil {
+			return fmt.Errorf("failed to decode %q: %v", line, err)
+		}
+		lines, decks = append(lines, line), append(decks, d)
+		return nil
+	})
+	return lines, decks, err
+}
+
+func diff(log *zap.SugaredLogger, in io.Reader, out io.Writer, catalog *deckstring.Catalog) int {
+	_, decks, err := readDecks(in)
+	if err != nil {
+		log.Error(err)
+		return 1
+	} else if len(decks) != 2 {
+		log.Errorf("-diff expects 2 deckstrings, got %d", len(decks))
+		return 1
+	}
+
+	if catalog == nil {
+		added, removed := deckstring.Compare(decks[0], decks[1])
+		for _, c := range removed {
+			fmt.Fprintf(out, "- %dx %d\n", c.Count, c.DBF)
+		}
+		for _, c := range added {
+			fmt.Fprintf(out, "+ %dx %d\n", c.Count, c.DBF)
+		}
+		return 0
+	}
+
+	d, err := catalog.Diff(decks[0], decks[1])
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	fmt.Fprintln(out, d)
+	return 0
+}
+
+func cluster(log *zap.SugaredLogger, in io.Reader, out io.Writer, threshold float64) int {
+	lines, decks, err := readDecks(in)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	for i, a := range deckstring.Cluster(decks, threshold) {
+		fmt.Fprintf(out, "archetype %d (%d decks, %d core cards)\n", i+1, len(a.Decks), len(a.Core))
+		for _, d := range a.Decks {
+			fmt.Fprintf(out, "  %s\n", lines[d])
+		}
+	}
+	return 0
+}
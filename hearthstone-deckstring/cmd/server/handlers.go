@@ -0,0 +1,187 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	deckstring "github.com/1gm/x/hearthstone-deckstring"
+	"github.com/1gm/x/internal/log"
+	"github.com/go-chi/chi"
+)
+
+// maxRequestSize limits the size of request bodies, a full deck is a few hundred bytes.
+const maxRequestSize = 1 << 16
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs the method, path, status and duration of every request.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := log.Put(r.Context(), "method", r.Method, "path", r.URL.Path)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		log.Infow(ctx, "request", "status", rec.status, "duration", time.Since(start))
+	})
+}
+
+type deckResponse struct {
+	Deckstring string               `json:"deckstring"`
+	Deck       deckstring.Deck      `json:"deck"`
+	List       *deckstring.DeckList `json:"list,omitempty"`
+	Stats      *deckstring.Stats    `json:"stats,omitempty"`
+}
+
+// newDeckResponse builds the response for d, resolving its cards when catalog is not nil.
+func newDeckResponse(catalog *deckstring.Catalog, d deckstring.Deck) (deckResponse, error) {
+	res := deckResponse{Deckstring: d.Encode(), Deck: d.Canonical()}
+	if catalog == nil {
+		return res, nil
+	}
+
+	dl, err := catalog.Resolve(d)
+	if err != nil {
+		return deckResponse{}, err
+	}
+	stats := dl.Stats()
+	res.List, res.Stats = &dl, &stats
+	return res, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// resolveStatus returns the status code for an error from newDeckResponse.
+func resolveStatus(err error) int {
+	var unknown *deckstring.UnknownCardError
+	if errors.As(err, &unknown) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func handleGetDeck(catalog *deckstring.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, err := deckstring.Decode(chi.URLParam(r, "*"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		res, err := newDeckResponse(catalog, d)
+		if err != nil {
+			writeError(w, resolveStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+type encodeRequest struct {
+	Format     deckstring.Format          `json:"format"`
+	Heroes     []uint64                   `json:"heroes"`
+	Cards      []deckstring.Card          `json:"cards"`
+	Sideboards []deckstring.SideboardCard `json:"sideboards"`
+}
+
+func handleEncodeDeck(catalog *deckstring.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req encodeRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		} else if len(req.Heroes) == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("at least one hero is required"))
+			return
+		}
+
+		// every card is listed with its count, Encode moves them into the right sections
+		d := deckstring.Deck{
+			Version:    deckstring.Version,
+			Format:     req.Format,
+			Heroes:     req.Heroes,
+			NCards:     req.Cards,
+			Sideboards: req.Sideboards,
+		}
+		res, err := newDeckResponse(catalog, d)
+		if err != nil {
+			writeError(w, resolveStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+//go:embed deck.html
+var templates embed.FS
+
+var deckTemplate = template.Must(template.New("deck.html").Funcs(template.FuncMap{
+	"curveLabel": deckstring.CurveLabel,
+	"percent": func(n, max int) int {
+		if max == 0 {
+			return 0
+		}
+		return 100 * n / max
+	},
+}).ParseFS(templates, "deck.html"))
+
+type deckView struct {
+	Name       string
+	Deckstring string
+	List       deckstring.DeckList
+	Stats      deckstring.Stats
+	MaxCurve   int
+}
+
+// handleViewDeck renders a deck as HTML. The page has a transparent background so it can
+// be used as a browser source on stream, the optional name query parameter sets the title.
+func handleViewDeck(catalog *deckstring.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if catalog == nil {
+			http.Error(w, "deck view requires a card catalog", http.StatusNotImplemented)
+			return
+		}
+
+		d, err := deckstring.Decode(chi.URLParam(r, "*"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dl, err := catalog.Resolve(d)
+		if err != nil {
+			http.Error(w, err.Error(), resolveStatus(err))
+			return
+		}
+
+		view := deckView{Name: r.FormValue("name"), Deckstring: d.Encode(), List: dl, Stats: dl.Stats()}
+		for _, n := range view.Stats.Curve {
+			if n > view.MaxCurve {
+				view.MaxCurve = n
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err = deckTemplate.Execute(w, view); err != nil {
+			log.Errorf(r.Context(), "failed to render deck: %v", err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	deckstring "github.com/1gm/x/hearthstone-deckstring"
+	"github.com/1gm/x/internal/log"
+	"github.com/go-chi/chi"
+)
+
+func main() {
+	httpAddr := flag.Int("p", 8082, "http port to listen on")
+	cardsFile := flag.String("cards", "", "path to a HearthstoneJSON cards.json file used to resolve card names (optional)")
+	flag.Parse()
+
+	os.Exit(realMain(fmt.Sprintf(":%d", *httpAddr), *cardsFile))
+}
+
+func realMain(httpAddr string, cardsFile string) int {
+	log := log.New()
+	defer log.Sync()
+
+	var catalog *deckstring.Catalog
+	if cardsFile != "" {
+		var err error
+		if catalog, err = deckstring.LoadCatalog(cardsFile); err != nil {
+			log.Errorf("failed to load card catalog: %v", err)
+			return 1
+		}
+		log.Infof("loaded card catalog from %s", cardsFile)
+	} else {
+		log.Info("no card catalog specified, decks will only contain DBF IDs")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, os.Kill)
+	go func() { <-c; cancel() }()
+
+	r := chi.NewRouter()
+	r.Use(logRequests)
+	// deckstrings may contain '/' so they are matched with a wildcard rather than a
+	// URL parameter.
+	r.Get("/decks/*", handleGetDeck(catalog))
+	r.Post("/decks", handleEncodeDeck(catalog))
+	r.Get("/view/*", handleViewDeck(catalog))
+
+	server := &http.Server{Addr: httpAddr, Handler: r}
+	closeCh := make(chan bool)
+	go func() {
+		log.Infof("starting deck server on %s", httpAddr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("error occured during http server startup: %v", err)
+		}
+		closeCh <- true
+	}()
+
+	var exitCode int
+	select {
+	case <-ctx.Done():
+		log.Info("shutting down")
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Errorf("failed to shut down server: %v", err)
+			exitCode = 1
+		}
+	case <-closeCh:
+		exitCode = 1
+	}
+	return exitCode
+}
@@ -0,0 +1,117 @@
+// Package deckstring implements Hearthstone deckstring encoding and decoding.
+package deckstring
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Version is the only deckstring version this package understands.
+const Version = 1
+
+// Deck is a decoded Hearthstone deckstring.
+type Deck struct {
+	Version     uint64   `json:"version"`
+	Format      Format   `json:"format"`
+	Heroes      []uint64 `json:"heroes"`
+	SingleCards []uint64 `json:"singleCards"`
+	DoubleCards []uint64 `json:"doubleCards"`
+	NCards      []Card   `json:"nCards"`
+	// Sideboards holds cards kept outside the main deck, e.g. E.T.C., Band Manager's band.
+	Sideboards []SideboardCard `json:"sideboards,omitempty"`
+}
+
+// Card is a card DBF ID and the number of copies of it in a deck.
+type Card struct {
+	DBF   uint64 `json:"dbf"`
+	Count uint64 `json:"count"`
+}
+
+// SideboardCard is a card in the sideboard belonging to the main deck card Owner.
+type SideboardCard struct {
+	Card
+	Owner uint64 `json:"owner"`
+}
+
+func (d Deck) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("hero dbfs: %v\n", d.Heroes))
+	sb.WriteString(fmt.Sprintf("format: %s\n", d.Format))
+	sb.WriteString(fmt.Sprintf("single cards: %v\n", d.SingleCards))
+	sb.WriteString(fmt.Sprintf("double cards: %v\n", d.DoubleCards))
+	sb.WriteString(fmt.Sprintf("n cards: %v", d.NCards))
+	if len(d.Sideboards) > 0 {
+		sb.WriteString(fmt.Sprintf("\nsideboards: %v", d.Sideboards))
+	}
+	return sb.String()
+}
+
+// Encode returns the canonical base64 deckstring for d, see Canonical.
+func (d Deck) Encode() string {
+	d = d.Canonical()
+	uvarint := func(v uint64) []byte {
+		b := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(b, v)
+		return b[:n]
+	}
+
+	var buf bytes.Buffer
+	buf.Write(uvarint(0)) // magic 0
+	buf.Write(uvarint(d.Version))
+	buf.Write(uvarint(uint64(d.Format)))
+	buf.Write(uvarint(uint64(len(d.Heroes))))
+	for i := 0; i < len(d.Heroes); i++ {
+		buf.Write(uvarint(d.Heroes[i]))
+	}
+	buf.Write(uvarint(uint64(len(d.SingleCards))))
+	for i := 0; i < len(d.SingleCards); i++ {
+		buf.Write(uvarint(d.SingleCards[i]))
+	}
+	buf.Write(uvarint(uint64(len(d.DoubleCards))))
+	for i := 0; i < len(d.DoubleCards); i++ {
+		buf.Write(uvarint(d.DoubleCards[i]))
+	}
+	buf.Write(uvarint(uint64(len(d.NCards))))
+	for i := 0; i < len(d.NCards); i++ {
+		buf.Write(uvarint(d.NCards[i].DBF))
+		buf.Write(uvarint(d.NCards[i].Count))
+	}
+
+	// the sideboard block is optional, decks without one are written in the older
+	// format so their deckstrings are unchanged.
+	if len(d.Sideboards) == 0 {
+		return b64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+
+	buf.Write(uvarint(1)) // has sideboards
+	for _, section := range [][]SideboardCard{sideboardSection(d.Sideboards, 1), sideboardSection(d.Sideboards, 2)} {
+		buf.Write(uvarint(uint64(len(section))))
+		for _, c := range section {
+			buf.Write(uvarint(c.DBF))
+			buf.Write(uvarint(c.Owner))
+		}
+	}
+	section := sideboardSection(d.Sideboards, 0)
+	buf.Write(uvarint(uint64(len(section))))
+	for _, c := range section {
+		buf.Write(uvarint(c.DBF))
+		buf.Write(uvarint(c.Count))
+		buf.Write(uvarint(c.Owner))
+	}
+	return b64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// sideboardSection returns the cards in sideboards with the given count, a count of 0
+// selects every card with more than 2 copies.
+func sideboardSection(sideboards []SideboardCard, count uint64) []SideboardCard {
+	var section []SideboardCard
+	for _, c := range sideboards {
+		if c.Count == count || (count == 0 && c.Count > 2) {
+			section = append(section, c)
+		}
+	}
+	return section
+}
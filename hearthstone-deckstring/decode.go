@@ -0,0 +1,211 @@
+package deckstring
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// DefaultMaxSectionSize is the largest hero, card or sideboard section accepted by Decode.
+// Real decks are far smaller, it exists so untrusted input can't request huge allocations.
+const DefaultMaxSectionSize = 100
+
+// Decoder decodes deckstrings. The zero value only limits section sizes by the length of
+// the input, use Decode for sensible defaults when handling untrusted input.
+type Decoder struct {
+	// MaxSectionSize is the maximum number of entries in each hero, card or sideboard
+	// section, 0 means no limit.
+	MaxSectionSize uint64
+	// Strict rejects deckstrings with data after the last section instead of ignoring it.
+	Strict bool
+}
+
+// Decode parses a deckstring using DefaultMaxSectionSize, ignoring any trailing data. See
+// Decoder.Decode.
+func Decode(deck string) (Deck, error) {
+	return Decoder{MaxSectionSize: DefaultMaxSectionSize}.Decode(deck)
+}
+
+// Decode parses a base64 deckstring. Whitespace, missing padding and the URL-safe base64
+// alphabet are tolerated. Errors are one of *Base64Error, *MagicError, *VersionError,
+// *TruncatedError, *SectionSizeError or *TrailingDataError depending on the stage decoding
+// failed at.
+func (dec Decoder) Decode(deck string) (Deck, error) {
+	b, err := decodeBase64(deck)
+	if err != nil {
+		return Deck{}, &Base64Error{Err: err}
+	}
+
+	if len(b) == 0 {
+		return Deck{}, &TruncatedError{Section: "header", Err: io.ErrUnexpectedEOF}
+	} else if b[0] != 0 {
+		return Deck{}, &MagicError{Got: b[0]}
+	}
+
+	r := reader{Reader: bytes.NewReader(b[1:]), max: dec.MaxSectionSize}
+	var d Deck
+
+	if d.Version, err = r.uvarint("version"); err != nil {
+		return Deck{}, err
+	}
+
+	if d.Version != Version {
+		return Deck{}, &VersionError{Version: d.Version}
+	}
+
+	format, err := r.uvarint("format")
+	if err != nil {
+		return Deck{}, err
+	}
+	d.Format = Format(format)
+
+	if d.Heroes, err = r.ids("hero"); err != nil {
+		return Deck{}, err
+	}
+
+	if d.SingleCards, err = r.ids("single quantity card"); err != nil {
+		return Deck{}, err
+	}
+
+	if d.DoubleCards, err = r.ids("double quantity card"); err != nil {
+		return Deck{}, err
+	}
+
+	nCount, err := r.count("N quantity card", 2)
+	if err != nil {
+		return Deck{}, err
+	}
+
+	d.NCards = make([]Card, nCount)
+	for i := uint64(0); i < nCount; i++ {
+		if d.NCards[i].DBF, err = r.uvarint("N quantity card DBF IDs"); err != nil {
+			return Deck{}, err
+		}
+		if d.NCards[i].Count, err = r.uvarint("N quantity card counts"); err != nil {
+			return Deck{}, err
+		}
+	}
+
+	// older deckstrings end after the main deck, newer ones have a flag which is set
+	// to 1 when a sideboard block follows.
+	if r.Len() == 0 {
+		return d, nil
+	}
+	hasSideboards, err := r.uvarint("sideboard flag")
+	if err != nil {
+		return Deck{}, err
+	}
+
+	switch hasSideboards {
+	case 0:
+	case 1:
+		if d.Sideboards, err = r.sideboards(); err != nil {
+			return Deck{}, err
+		}
+	default:
+		if dec.Strict {
+			return Deck{}, &TrailingDataError{Bytes: r.Len() + 1}
+		}
+		return d, nil
+	}
+
+	if dec.Strict && r.Len() > 0 {
+		return Deck{}, &TrailingDataError{Bytes: r.Len()}
+	}
+	return d, nil
+}
+
+// decodeBase64 decodes s with either the standard or URL-safe alphabet, ignoring
+// whitespace and padding.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return -1
+		case r == '-':
+			return '+'
+		case r == '_':
+			return '/'
+		}
+		return r
+	}, s)
+	return b64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+type reader struct {
+	*bytes.Reader
+	max uint64
+}
+
+func (r reader) uvarint(section string) (uint64, error) {
+	v, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, &TruncatedError{Section: section, Err: err}
+	}
+	return v, nil
+}
+
+// count reads the number of entries in section, where each entry is at least width bytes,
+// and checks it against the size limit and the remaining input.
+func (r reader) count(section string, width int) (uint64, error) {
+	n, err := r.uvarint(section + " count")
+	if err != nil {
+		return 0, err
+	}
+	if r.max > 0 && n > r.max {
+		return 0, &SectionSizeError{Section: section, Size: n, Max: r.max}
+	}
+	if n > uint64(r.Len()/width) {
+		return 0, &TruncatedError{Section: section + " entries", Err: io.ErrUnexpectedEOF}
+	}
+	return n, nil
+}
+
+func (r reader) ids(section string) ([]uint64, error) {
+	n, err := r.count(section, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, n)
+	for i := range ids {
+		if ids[i], err = r.uvarint(section + " DBF IDs"); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func (r reader) sideboards() ([]SideboardCard, error) {
+	var sideboards []SideboardCard
+	for _, section := range []struct {
+		name  string
+		count uint64
+		width int
+	}{{"single quantity sideboard card", 1, 2}, {"double quantity sideboard card", 2, 2}, {"N quantity sideboard card", 0, 3}} {
+		n, err := r.count(section.name, section.width)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := uint64(0); i < n; i++ {
+			c := SideboardCard{Card: Card{Count: section.count}}
+			if c.DBF, err = r.uvarint(section.name + " DBF IDs"); err != nil {
+				return nil, err
+			}
+			if section.count == 0 {
+				if c.Count, err = r.uvarint(section.name + " counts"); err != nil {
+					return nil, err
+				}
+			}
+			if c.Owner, err = r.uvarint(section.name + " owner DBF IDs"); err != nil {
+				return nil, err
+			}
+			sideboards = append(sideboards, c)
+		}
+	}
+	return sideboards, nil
+}
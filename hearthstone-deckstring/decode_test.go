@@ -0,0 +1,220 @@
+package deckstring
+
+import (
+	b64 "encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testDeckstring = "AAECAR8GxwPJBLsFmQfZB/gIDI0B2AGoArUDhwSSBe0G6wfbCe0JgQr+DAA="
+
+// raw encodes the uvarints vs as a standard base64 deckstring, every value must be < 128.
+func raw(vs ...byte) string {
+	return b64.StdEncoding.EncodeToString(vs)
+}
+
+func TestDecode(t *testing.T) {
+	d, err := Decode(testDeckstring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Version != Version || d.Format != FormatStandard {
+		t.Errorf("got version %d format %s", d.Version, d.Format)
+	}
+	if len(d.Heroes) != 1 || d.Heroes[0] != 31 {
+		t.Errorf("got heroes %v, want [31]", d.Heroes)
+	}
+	if len(d.SingleCards) != 6 || len(d.DoubleCards) != 12 || len(d.NCards) != 0 {
+		t.Errorf("got %d single, %d double and %d N cards, want 6, 12 and 0", len(d.SingleCards), len(d.DoubleCards), len(d.NCards))
+	}
+	if got := d.Encode(); got != testDeckstring {
+		t.Errorf("Encode() = %s, want %s", got, testDeckstring)
+	}
+}
+
+func TestDecodeLenientInput(t *testing.T) {
+	// bytes which encode to '+' and '/' so the URL-safe alphabet is exercised
+	d := Deck{Version: Version, Format: FormatStandard, Heroes: []uint64{1}, SingleCards: []uint64{0x3efb, 0x3fff}}
+	std := d.Encode()
+	if !strings.ContainsAny(std, "+/") {
+		t.Fatalf("test deck %s does not use '+' or '/'", std)
+	}
+	url := strings.NewReplacer("+", "-", "/", "_").Replace(std)
+
+	for name, input := range map[string]string{
+		"standard":          std,
+		"url safe":          url,
+		"unpadded":          strings.TrimRight(std, "="),
+		"url safe unpadded": strings.TrimRight(url, "="),
+		"whitespace":        " \t" + std[:4] + "\n" + std[4:] + " \r\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := Decode(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(d) {
+				t.Errorf("Decode(%q) = %v, want %v", input, got, d)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		check func(error) bool
+	}{
+		{"invalid base64", "AAEC!!", func(err error) bool {
+			var e *Base64Error
+			return errors.As(err, &e)
+		}},
+		{"empty", "", func(err error) bool {
+			var e *TruncatedError
+			return errors.As(err, &e) && e.Section == "header"
+		}},
+		{"magic", raw(1, 1, 1, 0, 0, 0, 0), func(err error) bool {
+			var e *MagicError
+			return errors.As(err, &e) && e.Got == 1
+		}},
+		{"version", raw(0, 2, 1, 0, 0, 0, 0), func(err error) bool {
+			var e *VersionError
+			return errors.As(err, &e) && e.Version == 2
+		}},
+		{"truncated format", raw(0, 1), func(err error) bool {
+			var e *TruncatedError
+			return errors.As(err, &e) && e.Section == "format"
+		}},
+		{"truncated heroes", raw(0, 1, 1, 2, 7), func(err error) bool {
+			var e *TruncatedError
+			return errors.As(err, &e) && e.Section == "hero entries"
+		}},
+		{"truncated varint", raw(0, 1, 1, 1, 0x80), func(err error) bool {
+			var e *TruncatedError
+			return errors.As(err, &e) && e.Section == "hero DBF IDs"
+		}},
+		{"truncated N cards", raw(0, 1, 1, 0, 0, 0, 1, 5), func(err error) bool {
+			var e *TruncatedError
+			return errors.As(err, &e) && e.Section == "N quantity card entries"
+		}},
+		{"truncated sideboards", raw(0, 1, 1, 0, 0, 0, 0, 1, 1), func(err error) bool {
+			var e *TruncatedError
+			return errors.As(err, &e) && e.Section == "single quantity sideboard card entries"
+		}},
+		{"section size", raw(0, 1, 1, DefaultMaxSectionSize+1), func(err error) bool {
+			var e *SectionSizeError
+			return errors.As(err, &e) && e.Section == "hero" && e.Size == DefaultMaxSectionSize+1 && e.Max == DefaultMaxSectionSize
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.input)
+			if err == nil {
+				t.Fatalf("Decode(%q) succeeded", tt.input)
+			}
+			if !tt.check(err) {
+				t.Errorf("Decode(%q) = %T %v", tt.input, err, err)
+			}
+		})
+	}
+}
+
+func TestDecoderMaxSectionSize(t *testing.T) {
+	ids := make([]uint64, DefaultMaxSectionSize+1)
+	for i := range ids {
+		ids[i] = uint64(i + 1)
+	}
+	deck := Deck{Version: Version, Format: FormatWild, Heroes: []uint64{7}, SingleCards: ids}.Encode()
+
+	var sizeErr *SectionSizeError
+	if _, err := Decode(deck); !errors.As(err, &sizeErr) || sizeErr.Section != "single quantity card" {
+		t.Errorf("Decode() = %v, want a single quantity card *SectionSizeError", err)
+	}
+	// the zero Decoder only limits sections by the length of the input
+	d, err := Decoder{}.Decode(deck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.SingleCards) != len(ids) {
+		t.Errorf("got %d single cards, want %d", len(d.SingleCards), len(ids))
+	}
+	if _, err = (Decoder{MaxSectionSize: 10}).Decode(deck); !errors.As(err, &sizeErr) || sizeErr.Max != 10 {
+		t.Errorf("Decode() = %v, want a *SectionSizeError with Max 10", err)
+	}
+}
+
+func TestDecoderStrict(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		input    string
+		trailing int
+	}{
+		{"no sideboard flag", raw(0, 1, 1, 0, 0, 0, 0), 0},
+		{"no sideboards", raw(0, 1, 1, 0, 0, 0, 0, 0), 0},
+		{"after sideboard flag", raw(0, 1, 1, 0, 0, 0, 0, 0, 9, 9), 2},
+		{"unknown sideboard flag", raw(0, 1, 1, 0, 0, 0, 0, 5, 9), 2},
+		{"after sideboards", raw(0, 1, 1, 0, 0, 0, 0, 1, 0, 0, 0, 3), 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.input); err != nil {
+				t.Errorf("Decode() = %v, trailing data must be ignored", err)
+			}
+			_, err := Decoder{Strict: true}.Decode(tt.input)
+			if tt.trailing == 0 {
+				if err != nil {
+					t.Errorf("strict Decode() = %v", err)
+				}
+				return
+			}
+			var e *TrailingDataError
+			if !errors.As(err, &e) || e.Bytes != tt.trailing {
+				t.Errorf("strict Decode() = %v, want %d trailing bytes", err, tt.trailing)
+			}
+		})
+	}
+}
+
+func addDecodeSeeds(f *testing.F) {
+	f.Add(testDeckstring)
+	f.Add(Deck{
+		Version: Version, Format: FormatStandard, Heroes: []uint64{7},
+		SingleCards: []uint64{1, 2}, DoubleCards: []uint64{3}, NCards: []Card{{DBF: 4, Count: 3}},
+		Sideboards: []SideboardCard{{Card: Card{DBF: 5, Count: 1}, Owner: 1}, {Card: Card{DBF: 6, Count: 4}, Owner: 1}},
+	}.Encode())
+	f.Add("")
+	f.Add(raw(0, 1, 1, 0, 0, 0, 0, 5, 9))
+	f.Add(raw(0, 1, 1, 0x80))
+}
+
+func FuzzDecode(f *testing.F) {
+	addDecodeSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		// neither may panic or allocate without bound, errors are expected
+		Decode(s)
+		Decoder{Strict: true}.Decode(s)
+	})
+}
+
+func FuzzDecodeRoundTrip(f *testing.F) {
+	addDecodeSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		d, err := Decode(s)
+		if err != nil {
+			return
+		}
+		// canonical sections can be longer than the decoded ones, e.g. when N cards with a
+		// count of 1 move to the single cards, so the size limit does not apply
+		encoded := d.Encode()
+		d2, err := Decoder{Strict: true}.Decode(encoded)
+		if err != nil {
+			t.Fatalf("Decode(Encode(Decode(%q))) = %v", s, err)
+		}
+		if again := d2.Encode(); again != encoded {
+			t.Fatalf("Encode is not stable for %q: %s then %s", s, encoded, again)
+		}
+		if !d2.Equal(d) {
+			t.Fatalf("Decode(Encode(d)) = %v, want %v", d2, d)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package deckstring
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CurveSize is the number of mana curve buckets, the last bucket holds every card costing
+// CurveSize-1 or more.
+const CurveSize = 8
+
+// Curve is the number of cards at each mana cost, see CurveSize.
+type Curve [CurveSize]int
+
+func manaCurve(cards []DeckListCard) Curve {
+	var c Curve
+	for _, card := range cards {
+		cost := card.Cost
+		if cost >= CurveSize {
+			cost = CurveSize - 1
+		} else if cost < 0 {
+			cost = 0
+		}
+		c[cost] += int(card.Count)
+	}
+	return c
+}
+
+// CurveLabel returns the label for the curve bucket i, e.g. "3" or "7+", the last bucket
+// holds every card costing CurveSize-1 or more.
+func CurveLabel(i int) string {
+	if i == CurveSize-1 {
+		return fmt.Sprintf("%d+", i)
+	}
+	return fmt.Sprint(i)
+}
+
+// Compare returns the cards which need to be added to and removed from the deck from to
+// get the deck to, sorted by DBF ID.
+func Compare(from, to Deck) (added, removed []Card) {
+	counts := make(map[uint64]int64)
+	for _, c := range from.Cards() {
+		counts[c.DBF] -= int64(c.Count)
+	}
+	for _, c := range to.Cards() {
+		counts[c.DBF] += int64(c.Count)
+	}
+
+	ids := make([]uint64, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		switch n := counts[id]; {
+		case n > 0:
+			added = append(added, Card{DBF: id, Count: uint64(n)})
+		case n < 0:
+			removed = append(removed, Card{DBF: id, Count: uint64(-n)})
+		}
+	}
+	return added, removed
+}
+
+// DeckDiff describes the changes between two decks.
+type DeckDiff struct {
+	Added   []DeckListCard `json:"added"`
+	Removed []DeckListCard `json:"removed"`
+	// Curve is the change in the number of cards at each mana cost.
+	Curve Curve `json:"curve"`
+}
+
+// Diff compares from and to, resolving the changed cards against c.
+func (c *Catalog) Diff(from, to Deck) (DeckDiff, error) {
+	fromList, err := c.Resolve(from)
+	if err != nil {
+		return DeckDiff{}, err
+	}
+	toList, err := c.Resolve(to)
+	if err != nil {
+		return DeckDiff{}, err
+	}
+
+	var diff DeckDiff
+	added, removed := Compare(from, to)
+	for _, card := range added {
+		info, _ := c.Card(card.DBF)
+		diff.Added = append(diff.Added, DeckListCard{CardInfo: info, Count: card.Count})
+	}
+	for _, card := range removed {
+		info, _ := c.Card(card.DBF)
+		diff.Removed = append(diff.Removed, DeckListCard{CardInfo: info, Count: card.Count})
+	}
+	sortDeckListCards(diff.Added)
+	sortDeckListCards(diff.Removed)
+
+	fromCurve, toCurve := manaCurve(fromList.Cards), manaCurve(toList.Cards)
+	for i := range diff.Curve {
+		diff.Curve[i] = toCurve[i] - fromCurve[i]
+	}
+	return diff, nil
+}
+
+func (d DeckDiff) String() string {
+	var sb strings.Builder
+	for _, c := range d.Removed {
+		sb.WriteString(fmt.Sprintf("- %dx (%d) %s\n", c.Count, c.Cost, c.Name))
+	}
+	for _, c := range d.Added {
+		sb.WriteString(fmt.Sprintf("+ %dx (%d) %s\n", c.Count, c.Cost, c.Name))
+	}
+	sb.WriteString("curve:")
+	for i, n := range d.Curve {
+		sb.WriteString(fmt.Sprintf(" %s=%+d", CurveLabel(i), n))
+	}
+	return sb.String()
+}
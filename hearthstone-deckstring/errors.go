@@ -0,0 +1,72 @@
+package deckstring
+
+import "fmt"
+
+// Base64Error is returned by Decode when the deckstring is not valid base64.
+type Base64Error struct {
+	Err error
+}
+
+func (e *Base64Error) Error() string { return fmt.Sprintf("invalid base64: %v", e.Err) }
+
+func (e *Base64Error) Unwrap() error { return e.Err }
+
+// MagicError is returned by Decode when the reserved header byte is not 0.
+type MagicError struct {
+	Got byte
+}
+
+func (e *MagicError) Error() string {
+	return fmt.Sprintf("invalid header value, expected 0 got %d", e.Got)
+}
+
+// VersionError is returned by Decode when the deckstring version is not supported.
+type VersionError struct {
+	Version uint64
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("invalid version, expected %d got %d", Version, e.Version)
+}
+
+// TruncatedError is returned by Decode when the deckstring ends before Section could be read.
+type TruncatedError struct {
+	Section string
+	Err     error
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("failed to read %s: %v", e.Section, e.Err)
+}
+
+func (e *TruncatedError) Unwrap() error { return e.Err }
+
+// SectionSizeError is returned by Decode when a section has more entries than allowed.
+type SectionSizeError struct {
+	Section string
+	Size    uint64
+	Max     uint64
+}
+
+func (e *SectionSizeError) Error() string {
+	return fmt.Sprintf("%s section has %d entries, at most %d allowed", e.Section, e.Size, e.Max)
+}
+
+// TrailingDataError is returned by a strict Decoder when bytes follow the last section.
+type TrailingDataError struct {
+	Bytes int
+}
+
+func (e *TrailingDataError) Error() string {
+	return fmt.Sprintf("%d unexpected bytes after the last section", e.Bytes)
+}
+
+// RotationError is returned by Validator.Validate when the deck's format rotates and the
+// Validator does not know which sets are legal in it.
+type RotationError struct {
+	Format Format
+}
+
+func (e *RotationError) Error() string {
+	return fmt.Sprintf("%s rotates, the card sets legal in it must be provided", e.Format)
+}
@@ -0,0 +1,46 @@
+package deckstring
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is the game format a deck is built for.
+type Format uint64
+
+const (
+	FormatUnknown  Format = 0
+	FormatWild     Format = 1
+	FormatStandard Format = 2
+	FormatClassic  Format = 3
+	FormatTwist    Format = 4
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatWild:
+		return "Wild"
+	case FormatStandard:
+		return "Standard"
+	case FormatClassic:
+		return "Classic"
+	case FormatTwist:
+		return "Twist"
+	default:
+		return fmt.Sprintf("Format(%d)", uint64(f))
+	}
+}
+
+// ParseFormat returns the Format named s, the names returned by Format.String are
+// accepted in any case.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range []Format{FormatWild, FormatStandard, FormatClassic, FormatTwist} {
+		if strings.EqualFold(s, f.String()) {
+			return f, nil
+		}
+	}
+	return FormatUnknown, fmt.Errorf("unknown format %q", s)
+}
+
+// Rotating reports whether the card sets legal in f change over time.
+func (f Format) Rotating() bool { return f == FormatStandard || f == FormatTwist }
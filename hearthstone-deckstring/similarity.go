@@ -0,0 +1,106 @@
+package deckstring
+
+import "sort"
+
+// Similarity returns the weighted Jaccard similarity of a and b: the number of card copies
+// the decks share divided by the number of copies in either deck. Identical decks score 1,
+// decks without any cards in common score 0.
+func Similarity(a, b Deck) float64 {
+	counts := make(map[uint64][2]uint64)
+	for _, c := range a.Cards() {
+		n := counts[c.DBF]
+		n[0] = c.Count
+		counts[c.DBF] = n
+	}
+	for _, c := range b.Cards() {
+		n := counts[c.DBF]
+		n[1] = c.Count
+		counts[c.DBF] = n
+	}
+
+	var shared, total uint64
+	for _, n := range counts {
+		if n[0] < n[1] {
+			shared, total = shared+n[0], total+n[1]
+		} else {
+			shared, total = shared+n[1], total+n[0]
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(shared) / float64(total)
+}
+
+// Archetype is a group of similar decks.
+type Archetype struct {
+	// Decks are the indexes of the decks in the archetype.
+	Decks []int `json:"decks"`
+	// Core are the cards, with their minimum count, found in every deck of the archetype.
+	Core []Card `json:"core"`
+}
+
+// Cluster groups decks into archetypes. Two decks belong to the same archetype when there
+// is a chain of decks between them where each neighbouring pair has a Similarity of at
+// least threshold. Archetypes are ordered by size, largest first.
+func Cluster(decks []Deck, threshold float64) []Archetype {
+	parent := make([]int, len(decks))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range decks {
+		for j := i + 1; j < len(decks); j++ {
+			if Similarity(decks[i], decks[j]) >= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range decks {
+		r := find(i)
+		if _, ok := groups[r]; !ok {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], i)
+	}
+
+	archetypes := make([]Archetype, 0, len(roots))
+	for _, r := range roots {
+		archetypes = append(archetypes, Archetype{Decks: groups[r], Core: coreCards(decks, groups[r])})
+	}
+	sort.SliceStable(archetypes, func(i, j int) bool { return len(archetypes[i].Decks) > len(archetypes[j].Decks) })
+	return archetypes
+}
+
+// coreCards returns the cards found in every deck in members with their minimum count.
+func coreCards(decks []Deck, members []int) []Card {
+	core := decks[members[0]].Cards()
+	for _, m := range members[1:] {
+		counts := make(map[uint64]uint64)
+		for _, c := range decks[m].Cards() {
+			counts[c.DBF] = c.Count
+		}
+
+		var kept []Card
+		for _, c := range core {
+			if n := counts[c.DBF]; n > 0 {
+				if n < c.Count {
+					c.Count = n
+				}
+				kept = append(kept, c)
+			}
+		}
+		core = kept
+	}
+	return core
+}
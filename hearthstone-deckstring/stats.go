@@ -0,0 +1,140 @@
+package deckstring
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Stats summarises a resolved deck.
+type Stats struct {
+	Size        int     `json:"size"`
+	Curve       Curve   `json:"curve"`
+	AverageCost float64 `json:"averageCost"`
+	// Types is the number of cards of each card type, e.g. MINION, SPELL or WEAPON.
+	Types map[string]int `json:"types"`
+}
+
+// Stats returns the mana curve, average cost and card type breakdown of dl. Sideboard
+// cards are not included.
+func (dl DeckList) Stats() Stats {
+	s := Stats{Curve: manaCurve(dl.Cards), Types: make(map[string]int)}
+	var cost int
+	for _, c := range dl.Cards {
+		s.Size += int(c.Count)
+		s.Types[c.Type] += int(c.Count)
+		cost += c.Cost * int(c.Count)
+	}
+	if s.Size > 0 {
+		s.AverageCost = float64(cost) / float64(s.Size)
+	}
+	return s
+}
+
+func (s Stats) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("cards: %d, average cost: %.2f\n", s.Size, s.AverageCost))
+	sb.WriteString("curve:")
+	for i, n := range s.Curve {
+		sb.WriteString(fmt.Sprintf(" %s=%d", CurveLabel(i), n))
+	}
+
+	types := make([]string, 0, len(s.Types))
+	for t := range s.Types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	sb.WriteString("\ntypes:")
+	for _, t := range types {
+		sb.WriteString(fmt.Sprintf(" %s=%d", strings.ToLower(t), s.Types[t]))
+	}
+	return sb.String()
+}
+
+// CardsSeen returns the number of cards drawn by the given turn including the opening
+// hand, which is 3 cards on the play and 4 on the coin. Mulligans are not considered.
+func CardsSeen(turn int, onCoin bool) int {
+	if onCoin {
+		return 4 + turn
+	}
+	return 3 + turn
+}
+
+// Hypergeometric returns the probability of drawing at least atLeast of the successes
+// cards when drawing draws cards without replacement from population cards.
+func Hypergeometric(population, successes, draws, atLeast int) float64 {
+	if draws > population {
+		draws = population
+	}
+	var p float64
+	for k := atLeast; k <= successes && k <= draws; k++ {
+		p += math.Exp(lchoose(successes, k) + lchoose(population-successes, draws-k) - lchoose(population, draws))
+	}
+	return math.Min(p, 1)
+}
+
+// lchoose returns the natural log of n choose k, or -Inf when k is out of range.
+func lchoose(n, k int) float64 {
+	if k < 0 || k > n {
+		return math.Inf(-1)
+	}
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
+}
+
+// copies returns the deck size and the number of copies of each of dbfs in dl.
+func (dl DeckList) copies(dbfs []uint64) (size int, counts []int) {
+	counts = make([]int, len(dbfs))
+	for _, c := range dl.Cards {
+		size += int(c.Count)
+		for i, dbf := range dbfs {
+			if c.DBF == dbf {
+				counts[i] = int(c.Count)
+			}
+		}
+	}
+	return size, counts
+}
+
+// DrawAny returns the probability of having drawn at least one copy of any of dbfs by the
+// given turn.
+func (dl DeckList) DrawAny(turn int, onCoin bool, dbfs ...uint64) float64 {
+	size, counts := dl.copies(dbfs)
+	var successes int
+	for _, n := range counts {
+		successes += n
+	}
+	return Hypergeometric(size, successes, CardsSeen(turn, onCoin), 1)
+}
+
+// DrawAll returns the probability of having drawn at least one copy of every one of dbfs
+// by the given turn. The cost grows exponentially with the number of cards so it is meant
+// for small combos rather than whole decks.
+func (dl DeckList) DrawAll(turn int, onCoin bool, dbfs ...uint64) float64 {
+	size, counts := dl.copies(dbfs)
+	draws := CardsSeen(turn, onCoin)
+	if draws > size {
+		draws = size
+	}
+
+	// inclusion-exclusion over the subsets of cards which were missed entirely
+	var p float64
+	for set := 0; set < 1<<len(counts); set++ {
+		var missed, bits int
+		for i, n := range counts {
+			if set&(1<<i) != 0 {
+				missed += n
+				bits++
+			}
+		}
+		term := math.Exp(lchoose(size-missed, draws) - lchoose(size, draws))
+		if bits%2 == 1 {
+			term = -term
+		}
+		p += term
+	}
+	return math.Max(0, math.Min(p, 1))
+}
@@ -0,0 +1,80 @@
+package deckstring
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoDeckstring is returned by ParseText when the text does not contain a deckstring.
+var ErrNoDeckstring = errors.New("no deckstring found")
+
+// ParseText parses the text produced by the in-game "copy deck" button, e.g.
+//
+//	### My Deck
+//	# Class: Mage
+//	# Format: Standard
+//	#
+//	# 2x (1) Arcane Missiles
+//	#
+//	AAECAR8GxwPJBLsFmQfZB/gIDI0B2AGoArUDhwSSBe0G6wfbCe0JgQr+DAA=
+//
+// Comment lines are optional so a bare deckstring is also accepted. The deck is always
+// decoded from the deckstring, the comments are only used for the deck name which is
+// empty when there is no "###" line.
+func ParseText(text string) (name string, d Deck, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "###"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "###"))
+		case strings.HasPrefix(line, "#"):
+		default:
+			d, err = Decode(line)
+			return name, d, err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", Deck{}, err
+	}
+	return "", Deck{}, ErrNoDeckstring
+}
+
+// Text returns dl in the in-game "copy deck" format, the "###" name line is omitted when
+// name is empty.
+func (dl DeckList) Text(name string) string {
+	var sb strings.Builder
+	if name != "" {
+		sb.WriteString(fmt.Sprintf("### %s\n", name))
+	}
+	sb.WriteString(fmt.Sprintf("# Class: %s\n", className(dl.Class())))
+	sb.WriteString(fmt.Sprintf("# Format: %s\n", dl.Deck.Format))
+	sb.WriteString("#\n")
+	for _, c := range dl.Cards {
+		sb.WriteString(fmt.Sprintf("# %dx (%d) %s\n", c.Count, c.Cost, c.Name))
+		for _, sc := range dl.Sideboards[c.DBF] {
+			sb.WriteString(fmt.Sprintf("#   %dx (%d) %s\n", sc.Count, sc.Cost, sc.Name))
+		}
+	}
+	sb.WriteString("#\n")
+	sb.WriteString(dl.Deck.Encode() + "\n")
+	sb.WriteString("#\n")
+	sb.WriteString("# To use this deck, copy it to your clipboard and create a new deck in Hearthstone\n")
+	return sb.String()
+}
+
+// className converts a HearthstoneJSON class, e.g. DEMONHUNTER, to the name shown in game.
+func className(class string) string {
+	switch class {
+	case "DEMONHUNTER":
+		return "Demon Hunter"
+	case "DEATHKNIGHT":
+		return "Death Knight"
+	case "":
+		return "Unknown"
+	}
+	return strings.ToUpper(class[:1]) + strings.ToLower(class[1:])
+}
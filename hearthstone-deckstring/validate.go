@@ -0,0 +1,175 @@
+package deckstring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Rule identifies the deck building rule a Violation breaks.
+type Rule string
+
+const (
+	RuleDeckSize  Rule = "deck-size"
+	RuleCopyLimit Rule = "copy-limit"
+	RuleClass     Rule = "class"
+	RuleSet       Rule = "set"
+	RuleFormat    Rule = "format"
+)
+
+// Violation is a single deck building rule broken by a deck.
+type Violation struct {
+	Rule Rule `json:"rule"`
+	// DBF is the card breaking the rule, 0 for rules which apply to the whole deck.
+	DBF     uint64 `json:"dbf,omitempty"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string { return fmt.Sprintf("%s: %s", v.Rule, v.Message) }
+
+const (
+	deckSize         = 30
+	renathalDeckSize = 40
+	// princeRenathalID is the card ID of Prince Renathal, which increases the deck size to 40.
+	princeRenathalID = "REV_018"
+
+	rarityLegendary = "LEGENDARY"
+	classNeutral    = "NEUTRAL"
+)
+
+// DefaultSets lists the card sets which never change for a format. Standard and Twist
+// rotate, so the sets legal in them must be provided to the Validator, see LoadSets.
+var DefaultSets = map[Format][]string{
+	FormatClassic: {"VANILLA"},
+}
+
+// Validator checks decks against the deck building rules of their format.
+type Validator struct {
+	Catalog *Catalog
+	// Sets lists the card sets legal in each format. Formats which do not rotate allow
+	// cards from every set when they have no entry, rotating formats cannot be validated.
+	Sets map[Format][]string
+}
+
+// LoadSets reads the card sets legal in each format from a JSON file, see ReadSets.
+func LoadSets(filename string) (map[Format][]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSets(f)
+}
+
+// ReadSets reads a JSON object mapping format names to the card sets legal in them, e.g.
+//
+//	{"Standard": ["CORE", "EVENT", "WHIZBANGS_WORKSHOP"], "Twist": ["EXPERT1", "NAXX"]}
+func ReadSets(r io.Reader) (map[Format][]string, error) {
+	var named map[string][]string
+	if err := json.NewDecoder(r).Decode(&named); err != nil {
+		return nil, fmt.Errorf("failed to decode sets: %v", err)
+	}
+	sets := make(map[Format][]string, len(named))
+	for name, s := range named {
+		f, err := ParseFormat(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sets: %v", err)
+		}
+		sets[f] = s
+	}
+	return sets, nil
+}
+
+// NewValidator creates a Validator using catalog and DefaultSets.
+func NewValidator(catalog *Catalog) *Validator {
+	sets := make(map[Format][]string, len(DefaultSets))
+	for f, s := range DefaultSets {
+		sets[f] = s
+	}
+	return &Validator{Catalog: catalog, Sets: sets}
+}
+
+// Validate returns every rule broken by d, an empty result means the deck is legal. An
+// error is only returned when the deck cannot be checked, e.g. it contains unknown cards
+// or its format rotates and v has no sets for it (*RotationError).
+func (v *Validator) Validate(d Deck) ([]Violation, error) {
+	sets, checkSets := v.Sets[d.Format]
+	if !checkSets && d.Format.Rotating() {
+		return nil, &RotationError{Format: d.Format}
+	}
+	dl, err := v.Catalog.Resolve(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []Violation
+	if d.Format == FormatUnknown {
+		violations = append(violations, Violation{Rule: RuleFormat, Message: "deck has no format"})
+	}
+
+	size := deckSize
+	var total uint64
+	for _, c := range dl.Cards {
+		total += c.Count
+		if c.ID == princeRenathalID {
+			size = renathalDeckSize
+		}
+	}
+	if total != uint64(size) {
+		violations = append(violations, Violation{
+			Rule:    RuleDeckSize,
+			Message: fmt.Sprintf("deck has %d cards, expected %d", total, size),
+		})
+	}
+
+	legal := make(map[string]bool)
+	for _, s := range sets {
+		legal[s] = true
+	}
+
+	class := dl.Class()
+	for _, c := range dl.Cards {
+		limit := uint64(2)
+		if c.Rarity == rarityLegendary {
+			limit = 1
+		}
+		if c.Count > limit {
+			violations = append(violations, Violation{
+				Rule:    RuleCopyLimit,
+				DBF:     c.DBF,
+				Message: fmt.Sprintf("%s has %d copies, at most %d allowed", c.Name, c.Count, limit),
+			})
+		}
+
+		if !playableBy(c.CardInfo, class) {
+			violations = append(violations, Violation{
+				Rule:    RuleClass,
+				DBF:     c.DBF,
+				Message: fmt.Sprintf("%s is a %s card and cannot be played by %s", c.Name, c.Class, class),
+			})
+		}
+
+		if checkSets && !legal[c.Set] {
+			violations = append(violations, Violation{
+				Rule:    RuleSet,
+				DBF:     c.DBF,
+				Message: fmt.Sprintf("%s from %s is not legal in %s", c.Name, c.Set, d.Format),
+			})
+		}
+	}
+	return violations, nil
+}
+
+// playableBy reports whether card can be put in a deck of the given class.
+func playableBy(card CardInfo, class string) bool {
+	if card.Class == classNeutral || card.Class == class {
+		return true
+	}
+	for _, c := range card.Classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
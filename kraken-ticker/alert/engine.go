@@ -0,0 +1,158 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+// Engine evaluates rules against each snapshot and sends the alerts raised to every
+// notifier in the background.
+type Engine struct {
+	log       *zap.SugaredLogger
+	rules     []Rule
+	notifiers []Notifier
+
+	mu    sync.Mutex
+	state []ruleState
+	wg    sync.WaitGroup
+}
+
+type ruleState struct {
+	// active is whether the condition held for the last snapshot and fired whether an
+	// alert was raised since it started to hold. A single alert is raised each time the
+	// condition starts to hold, delayed until the cooldown expires if it is still holding.
+	active    bool
+	fired     bool
+	lastFired time.Time
+	// history holds the prices within Window for Change rules.
+	history []point
+	// side is the sign of the last price minus the VWAP for VWAPCross rules.
+	side int
+}
+
+type point struct {
+	time  time.Time
+	price float64
+}
+
+// NewEngine creates an Engine, rules must be valid, see LoadConfig.
+func NewEngine(log *zap.SugaredLogger, rules []Rule, notifiers []Notifier) *Engine {
+	return &Engine{log: log, rules: rules, notifiers: notifiers, state: make([]ruleState, len(rules))}
+}
+
+// Evaluate checks records against every rule, returning the alerts raised. Records must be
+// in time order per pair.
+func (e *Engine) Evaluate(records ...store.Record) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var alerts []Alert
+	for _, r := range records {
+		if r.Last.Sign() <= 0 {
+			continue
+		}
+		for i, rule := range e.rules {
+			if rule.Pair != r.Pair {
+				continue
+			}
+			st := &e.state[i]
+			message, holds := rule.check(st, r)
+			if !holds {
+				st.active, st.fired = false, false
+				continue
+			}
+			if !st.active {
+				st.active, st.fired = true, false
+			}
+			cooling := !st.lastFired.IsZero() && r.Time.Sub(st.lastFired) < time.Duration(rule.Cooldown)
+			if st.fired || cooling {
+				continue
+			}
+			st.fired, st.lastFired = true, r.Time
+			alerts = append(alerts, Alert{
+				Rule:    rule.Name,
+				Type:    rule.Type,
+				Pair:    r.Pair,
+				Time:    r.Time.UTC(),
+				Price:   r.Last.Float64(),
+				Message: message,
+			})
+		}
+	}
+
+	for _, a := range alerts {
+		e.notify(a)
+	}
+	return alerts
+}
+
+func (e *Engine) notify(a Alert) {
+	for _, n := range e.notifiers {
+		e.wg.Add(1)
+		go func(n Notifier) {
+			defer e.wg.Done()
+			if err := n.Notify(context.Background(), a); err != nil {
+				e.log.Errorf("failed to send %q alert: %v", a.Rule, err)
+			}
+		}(n)
+	}
+}
+
+// Wait blocks until every notification sent so far has finished.
+func (e *Engine) Wait() { e.wg.Wait() }
+
+// check reports whether the rule's condition holds for r and describes it. Rules compare
+// floats, the record's decimals are converted here.
+func (rule Rule) check(st *ruleState, r store.Record) (string, bool) {
+	last := r.Last.Float64()
+	switch rule.Type {
+	case Above:
+		return fmt.Sprintf("%s last trade %v is above %v", r.Pair, r.Last, rule.Value), last > rule.Value
+	case Below:
+		return fmt.Sprintf("%s last trade %v is below %v", r.Pair, r.Last, rule.Value), last < rule.Value
+	case Change:
+		// the base price is the oldest price still inside the window
+		cutoff := r.Time.Add(-time.Duration(rule.Window))
+		i := 0
+		for i < len(st.history) && st.history[i].time.Before(cutoff) {
+			i++
+		}
+		st.history = append(st.history[i:], point{r.Time, last})
+		base := st.history[0].price
+		change := (last - base) / base * 100
+		return fmt.Sprintf("%s moved %+.2f%% from %v to %v within %s", r.Pair, change, base, r.Last, time.Duration(rule.Window)),
+			math.Abs(change) >= rule.Percent
+	case Spread:
+		if r.Ask.Sign() <= 0 || r.Bid.Sign() <= 0 {
+			return "", false
+		}
+		spread := r.Ask.Sub(r.Bid)
+		if rule.Percent > 0 {
+			pct := spread.Float64() / ((r.Ask.Float64() + r.Bid.Float64()) / 2) * 100
+			return fmt.Sprintf("%s spread %.4f%% is wider than %v%%", r.Pair, pct, rule.Percent), pct > rule.Percent
+		}
+		return fmt.Sprintf("%s spread %v is wider than %v", r.Pair, spread, rule.Value), spread.Float64() > rule.Value
+	case VWAPCross:
+		if r.VWAP24h.Sign() <= 0 {
+			return "", false
+		}
+		side := r.Last.Cmp(r.VWAP24h)
+		prev := st.side
+		if side != 0 {
+			st.side = side
+		}
+		direction := "above"
+		if side < 0 {
+			direction = "below"
+		}
+		return fmt.Sprintf("%s last trade %v crossed %s the 24h VWAP %v", r.Pair, r.Last, direction, r.VWAP24h),
+			prev != 0 && side != 0 && side != prev
+	}
+	return "", false
+}
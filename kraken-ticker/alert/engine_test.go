@@ -0,0 +1,43 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+func TestEvaluateCooldown(t *testing.T) {
+	rule := Rule{Name: "above", Pair: "XBT/USD", Type: Above, Value: 100, Cooldown: Duration(time.Hour)}
+	e := NewEngine(zap.NewNop().Sugar(), []Rule{rule}, nil)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		after time.Duration
+		last  int64
+		fire  bool
+	}{
+		{0, 101, true},
+		// still holding, the episode already fired
+		{10 * time.Minute, 102, false},
+		{20 * time.Minute, 99, false},
+		// a new episode starts during the cooldown and fires once it expires
+		{30 * time.Minute, 101, false},
+		{50 * time.Minute, 101, false},
+		{time.Hour, 101, true},
+		{70 * time.Minute, 101, false},
+		// a new episode which ends during the cooldown is not raised
+		{80 * time.Minute, 99, false},
+		{90 * time.Minute, 101, false},
+		{100 * time.Minute, 99, false},
+		{3 * time.Hour, 99, false},
+		{4 * time.Hour, 101, true},
+	} {
+		r := store.Record{Pair: "XBT/USD", Time: start.Add(tt.after), Last: decimal.New(tt.last, 0)}
+		if got := e.Evaluate(r); (len(got) == 1) != tt.fire || len(got) > 1 {
+			t.Errorf("at %s last %v: got %d alerts, want fire=%t", tt.after, tt.last, len(got), tt.fire)
+		}
+	}
+}
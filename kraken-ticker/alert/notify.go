@@ -0,0 +1,156 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Alert is raised when a rule's condition starts to hold.
+type Alert struct {
+	Rule    string    `json:"rule"`
+	Type    RuleType  `json:"type"`
+	Pair    string    `json:"pair"`
+	Time    time.Time `json:"time"`
+	Price   float64   `json:"price"`
+	Message string    `json:"message"`
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// NotifierConfig configures a notifier in an alerts file.
+type NotifierConfig struct {
+	// Type is "log", "webhook" or "exec".
+	Type string `json:"type"`
+	// URL is the address webhook notifiers POST the alert to as JSON.
+	URL string `json:"url"`
+	// Command is run by exec notifiers with the alert as JSON on stdin and in ALERT_*
+	// environment variables.
+	Command []string `json:"command"`
+	// Timeout limits each notification, defaults to 10s.
+	Timeout Duration `json:"timeout"`
+}
+
+func (c NotifierConfig) validate() error {
+	switch c.Type {
+	case "log":
+	case "webhook":
+		if c.URL == "" {
+			return fmt.Errorf("webhook notifier has no url")
+		}
+	case "exec":
+		if len(c.Command) == 0 {
+			return fmt.Errorf("exec notifier has no command")
+		}
+	default:
+		return fmt.Errorf("unknown notifier type %q", c.Type)
+	}
+	return nil
+}
+
+// New creates the notifier described by c.
+func (c NotifierConfig) New(log *zap.SugaredLogger) Notifier {
+	var n Notifier
+	switch c.Type {
+	case "webhook":
+		n = &WebhookNotifier{URL: c.URL, Client: http.DefaultClient}
+	case "exec":
+		n = &ExecNotifier{Command: c.Command}
+	default:
+		n = &LogNotifier{Log: log}
+	}
+	timeout := time.Duration(c.Timeout)
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return timeoutNotifier{n, timeout}
+}
+
+type timeoutNotifier struct {
+	Notifier
+	timeout time.Duration
+}
+
+func (n timeoutNotifier) Notify(ctx context.Context, a Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+	return n.Notifier.Notify(ctx, a)
+}
+
+// LogNotifier logs alerts as warnings.
+type LogNotifier struct {
+	Log *zap.SugaredLogger
+}
+
+func (n *LogNotifier) Notify(_ context.Context, a Alert) error {
+	n.Log.Warnw("alert: "+a.Message, "rule", a.Rule, "pair", a.Pair, "price", a.Price)
+	return nil
+}
+
+// WebhookNotifier POSTs alerts as JSON to URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to POST webhook: %v", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+	return nil
+}
+
+// ExecNotifier runs Command for each alert, the alert is written to its stdin as JSON and
+// set in the ALERT_RULE, ALERT_TYPE, ALERT_PAIR, ALERT_TIME, ALERT_PRICE and ALERT_MESSAGE
+// environment variables.
+type ExecNotifier struct {
+	Command []string
+}
+
+func (n *ExecNotifier) Notify(ctx context.Context, a Alert) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, n.Command[0], n.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Env = append(os.Environ(),
+		"ALERT_RULE="+a.Rule,
+		"ALERT_TYPE="+string(a.Type),
+		"ALERT_PAIR="+a.Pair,
+		"ALERT_TIME="+a.Time.UTC().Format(time.RFC3339),
+		"ALERT_PRICE="+strconv.FormatFloat(a.Price, 'f', -1, 64),
+		"ALERT_MESSAGE="+a.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", n.Command[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
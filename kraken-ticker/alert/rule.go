@@ -0,0 +1,140 @@
+// Package alert evaluates price alert rules against ticker snapshots and sends the
+// alerts they raise to notifiers.
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RuleType is the condition a Rule checks.
+type RuleType string
+
+const (
+	// Above fires when the last trade price rises above Value.
+	Above RuleType = "above"
+	// Below fires when the last trade price falls below Value.
+	Below RuleType = "below"
+	// Change fires when the last trade price moves by at least Percent, up or down, within
+	// Window.
+	Change RuleType = "change"
+	// Spread fires when the ask minus the bid is wider than Value, or Percent of the mid
+	// price when Percent is set.
+	Spread RuleType = "spread"
+	// VWAPCross fires when the last trade price crosses the 24 hour VWAP.
+	VWAPCross RuleType = "vwap-cross"
+)
+
+// Rule is an alert condition for a pair.
+type Rule struct {
+	// Name identifies the rule in alerts, it defaults to "<pair> <type>".
+	Name string   `json:"name"`
+	Pair string   `json:"pair"`
+	Type RuleType `json:"type"`
+	// Value is the price for Above and Below and the absolute spread for Spread.
+	Value   float64 `json:"value"`
+	Percent float64 `json:"percent"`
+	// Window is the period a Change is measured over.
+	Window Duration `json:"window"`
+	// Cooldown is the minimum time between two alerts from the rule. An alert is only
+	// raised when the condition starts to hold, so a price staying above a threshold raises
+	// a single alert regardless of the cooldown. A condition which starts to hold during
+	// the cooldown alerts when the cooldown expires if it still holds.
+	Cooldown Duration `json:"cooldown"`
+}
+
+func (r Rule) validate() error {
+	if r.Pair == "" {
+		return fmt.Errorf("rule %q has no pair", r.Name)
+	}
+	switch r.Type {
+	case Above, Below:
+		if r.Value <= 0 {
+			return fmt.Errorf("rule %q needs a positive value", r.Name)
+		}
+	case Change:
+		if r.Percent <= 0 || r.Window <= 0 {
+			return fmt.Errorf("rule %q needs a positive percent and window", r.Name)
+		}
+	case Spread:
+		if r.Value <= 0 && r.Percent <= 0 {
+			return fmt.Errorf("rule %q needs a positive value or percent", r.Name)
+		}
+	case VWAPCross:
+	default:
+		return fmt.Errorf("rule %q has unknown type %q", r.Name, r.Type)
+	}
+	return nil
+}
+
+// Duration is a time.Duration written as a string in JSON, e.g. "15m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string, e.g. \"5m\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config is an alerts file, see LoadConfig.
+type Config struct {
+	Rules     []Rule           `json:"rules"`
+	Notifiers []NotifierConfig `json:"notifiers"`
+}
+
+// LoadConfig reads and validates a JSON alerts file, e.g.
+//
+//	{
+//	  "rules": [
+//	    {"pair": "XXBTZUSD", "type": "above", "value": 70000, "cooldown": "1h"},
+//	    {"pair": "XXBTZUSD", "type": "change", "percent": 3, "window": "1h"}
+//	  ],
+//	  "notifiers": [
+//	    {"type": "log"},
+//	    {"type": "webhook", "url": "https://example.com/hook"},
+//	    {"type": "exec", "command": ["notify-send", "kraken"]}
+//	  ]
+//	}
+//
+// Alerts are logged when no notifiers are configured.
+func LoadConfig(filename string) (Config, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read alerts file: %v", err)
+	}
+	var c Config
+	if err = json.Unmarshal(b, &c); err != nil {
+		return Config{}, fmt.Errorf("failed to decode alerts file: %v", err)
+	}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("%s %s", r.Pair, r.Type)
+		}
+		if err = r.validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, n := range c.Notifiers {
+		if err = n.validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	if len(c.Notifiers) == 0 {
+		c.Notifiers = []NotifierConfig{{Type: "log"}}
+	}
+	return c, nil
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/1gm/x/internal/log"
+	"github.com/1gm/x/kraken-ticker/decimal"
+	"github.com/1gm/x/kraken-ticker/exchange"
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+type backfillOptions struct {
+	directory string
+	pair      string
+	from      string
+	to        string
+	interval  string
+	delay     time.Duration
+	retries   int
+	apiURL    string
+}
+
+// backfillMain implements the backfill subcommand, which fills in the candles of a pair
+// for a period the collector did not run.
+func backfillMain(args []string) int {
+	var opts backfillOptions
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fs.StringVar(&opts.directory, "o", "data", "output directory of the collector")
+	fs.StringVar(&opts.pair, "pair", "", "pair to backfill, e.g. XBTUSD or BTC/USD")
+	fs.StringVar(&opts.from, "from", "", "start of the period to backfill, RFC3339 or yyyy-mm-dd")
+	fs.StringVar(&opts.to, "to", "", "end of the period to backfill, RFC3339 or yyyy-mm-dd (defaults to now)")
+	fs.StringVar(&opts.interval, "interval", "1h", "candle interval, "+intervalNames)
+	fs.DurationVar(&opts.delay, "delay", time.Second, "minimum time between two requests, Kraken allows about one public request per second")
+	fs.IntVar(&opts.retries, "retries", 5, "number of times a failed request is retried")
+	fs.StringVar(&opts.apiURL, "api", kraken.DefaultBaseURL, "Kraken REST API base URL")
+	fs.Parse(args)
+
+	log := log.New()
+	defer log.Sync()
+
+	if opts.pair == "" {
+		log.Error("-pair is required")
+		return 1
+	}
+	from, err := parseQueryTime(opts.from)
+	if err != nil || from.IsZero() {
+		log.Errorf("invalid -from %q, expected RFC3339 or yyyy-mm-dd", opts.from)
+		return 1
+	}
+	to, err := parseQueryTime(opts.to)
+	if err != nil {
+		log.Errorf("invalid -to: %v", err)
+		return 1
+	}
+	interval, ok := intervals[opts.interval]
+	if !ok {
+		log.Errorf("invalid -interval %q, expected %s", opts.interval, intervalNames)
+		return 1
+	}
+	// only whole intervals which have ended are backfilled
+	from = from.UTC().Truncate(interval)
+	if now := time.Now().UTC().Truncate(interval); to.IsZero() || to.After(now) {
+		to = now
+	} else {
+		to = to.UTC().Truncate(interval)
+	}
+	if !from.Before(to) {
+		log.Errorf("nothing to backfill from %s to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+		return 1
+	}
+
+	st, err := store.Open(filepath.Join(opts.directory, "ticker"), store.CSV, store.WithLogger(log))
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() { <-c; cancel() }()
+
+	client := kraken.NewClient(kraken.WithBaseURL(opts.apiURL))
+	var resolved map[string]string
+	err = retry(ctx, opts.retries, startupBackoff, func(ctx context.Context) (err error) {
+		resolved, err = resolvePairs(ctx, exchange.NewKraken(client), []string{opts.pair})
+		return err
+	}, func(attempt int, delay time.Duration, err error) {
+		log.Warnf("failed to resolve pair, retry %d/%d in %s: %v", attempt, opts.retries, delay.Round(time.Millisecond), err)
+	})
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	pair := resolved[opts.pair]
+
+	b := &backfiller{
+		log:      log,
+		client:   client,
+		store:    st,
+		pair:     pair,
+		interval: interval,
+		to:       to,
+		delay:    opts.delay,
+		retries:  opts.retries,
+		checkpointFile: filepath.Join(opts.directory, "backfill",
+			fmt.Sprintf("%s-%s.json", pair, store.IntervalName(interval))),
+	}
+	if err = b.loadCheckpoint(from); err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	// intervals with snapshots are left to the collector's data, candles are only added
+	// where it has none
+	records, err := queryRecords(log, opts.directory, []string{pair}, b.cp.Next, to)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	b.covered = make(map[int64]bool)
+	for _, r := range records {
+		b.covered[r.Time.UTC().Truncate(interval).Unix()] = true
+	}
+
+	if err = b.run(ctx); errors.Is(err, context.Canceled) {
+		log.Warnf("interrupted, run the same command again to resume from %s", b.cp.Next.Format(time.RFC3339))
+		return 1
+	} else if err != nil {
+		log.Error(err)
+		return 1
+	}
+	if err = os.Remove(b.checkpointFile); err != nil && !os.IsNotExist(err) {
+		log.Error("failed to remove checkpoint: ", err)
+	}
+	log.Infof("backfilled %d %s candles of %s from %s to %s", b.cp.Added, store.IntervalName(interval), pair,
+		from.Format(time.RFC3339), to.Format(time.RFC3339))
+	return 0
+}
+
+// checkpoint is the progress of a backfill, saved after every page so an interrupted
+// backfill resumes where it stopped.
+type checkpoint struct {
+	Pair     string    `json:"pair"`
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	// Next is the start of the first interval which has not been backfilled yet.
+	Next time.Time `json:"next"`
+	// Added is the number of candles saved so far.
+	Added int `json:"added"`
+}
+
+// backfiller saves the candles of a pair from the OHLC endpoint, which only serves the
+// latest 720 candles, and builds older candles from the Trades endpoint.
+type backfiller struct {
+	log      *zap.SugaredLogger
+	client   *kraken.Client
+	store    *store.Store
+	pair     string
+	interval time.Duration
+	to       time.Time
+	// covered are the start times of the intervals with snapshots.
+	covered map[int64]bool
+
+	delay       time.Duration
+	retries     int
+	lastRequest time.Time
+
+	cp             checkpoint
+	checkpointFile string
+}
+
+// loadCheckpoint resumes from the checkpoint of an interrupted backfill of the same period,
+// or starts at from.
+func (b *backfiller) loadCheckpoint(from time.Time) error {
+	b.cp = checkpoint{Pair: b.pair, Interval: store.IntervalName(b.interval), From: from, To: b.to, Next: from}
+
+	data, err := os.ReadFile(b.checkpointFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	var cp checkpoint
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("failed to decode checkpoint %s: %v", b.checkpointFile, err)
+	}
+	// the end of an open ended backfill moves with the clock, so only the start must match
+	if !cp.From.Equal(from) || cp.Next.Before(from) {
+		b.log.Warnf("ignoring checkpoint %s of a backfill from %s", b.checkpointFile, cp.From.Format(time.RFC3339))
+		return nil
+	}
+	b.cp.Next, b.cp.Added = cp.Next, cp.Added
+	b.log.Infof("resuming backfill from %s", cp.Next.Format(time.RFC3339))
+	return nil
+}
+
+func (b *backfiller) saveCheckpoint() error {
+	data, err := json.MarshalIndent(b.cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(b.checkpointFile), 0755); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %v", err)
+	}
+	tmp := b.checkpointFile + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err == nil {
+		err = os.Rename(tmp, b.checkpointFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %v", err)
+	}
+	return nil
+}
+
+// request calls fn at least delay after the previous request, retrying temporary errors.
+// Rate limit errors wait at least 10 seconds before the retry.
+func (b *backfiller) request(ctx context.Context, endpoint string, fn func(ctx context.Context) error) error {
+	return retry(ctx, b.retries, backoff{base: time.Second, max: time.Minute, rateLimited: 10 * time.Second}, func(ctx context.Context) error {
+		if wait := time.Until(b.lastRequest.Add(b.delay)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		b.lastRequest = time.Now()
+		return fn(ctx)
+	}, func(attempt int, delay time.Duration, err error) {
+		b.log.Warnf("%s failed, retry %d/%d in %s: %v", endpoint, attempt, b.retries, delay.Round(time.Millisecond), err)
+	})
+}
+
+// run backfills from the checkpoint up to b.to.
+func (b *backfiller) run(ctx context.Context) error {
+	minutes := int(b.interval / time.Minute)
+	for b.cp.Next.Before(b.to) {
+		var candles []kraken.Candle
+		err := b.request(ctx, "OHLC", func(ctx context.Context) (err error) {
+			candles, _, err = b.client.OHLC(ctx, b.pair, minutes, b.cp.Next.Unix()-1)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get OHLC: %w", err)
+		}
+
+		// the OHLC endpoint starts at its oldest candle when since is further back, the
+		// intervals before it are built from trades
+		if len(candles) == 0 || candles[0].Time.After(b.cp.Next) {
+			end := b.to
+			if len(candles) > 0 && candles[0].Time.Before(end) {
+				end = candles[0].Time
+			}
+			if err = b.trades(ctx, end); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var page []store.Candle
+		next := b.cp.Next
+		for _, c := range candles {
+			if c.Time.Before(b.cp.Next) || !c.Time.Before(b.to) {
+				continue
+			}
+			page = append(page, store.Candle{
+				Time:   c.Time,
+				Pair:   b.pair,
+				Open:   c.Open.Float64(),
+				High:   c.High.Float64(),
+				Low:    c.Low.Float64(),
+				Close:  c.Close.Float64(),
+				Volume: c.Volume.Float64(),
+			})
+			next = c.Time.Add(b.interval)
+		}
+		if !next.After(b.cp.Next) {
+			// no candles for the rest of the period, e.g. the pair stopped trading
+			next = b.to
+		}
+		if err = b.save(page, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trades builds the candles from the checkpoint up to end from the Trades endpoint. The
+// checkpoint only moves past intervals whose trades have all been seen, so a resumed
+// backfill fetches the trades of a partially seen interval again.
+func (b *backfiller) trades(ctx context.Context, end time.Time) error {
+	since := b.cp.Next.UnixNano() - 1
+	var pending []kraken.Trade
+	for {
+		var (
+			trades []kraken.Trade
+			last   int64
+		)
+		err := b.request(ctx, "Trades", func(ctx context.Context) (err error) {
+			trades, last, err = b.client.Trades(ctx, b.pair, since, 0)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get trades: %w", err)
+		}
+
+		done := len(trades) == 0 || last <= since
+		for _, t := range trades {
+			if t.Time.Before(b.cp.Next) {
+				continue
+			}
+			if !t.Time.Before(end) {
+				done = true
+				break
+			}
+			pending = append(pending, t)
+		}
+
+		// the interval of the latest trade may continue on the next page
+		complete := end
+		if !done && len(pending) > 0 {
+			complete = pending[len(pending)-1].Time.Truncate(b.interval)
+		}
+		if !done && len(pending) == 0 {
+			since = last
+			continue
+		}
+		i := sort.Search(len(pending), func(i int) bool { return !pending[i].Time.Before(complete) })
+		if err = b.save(candlesFromTrades(b.pair, pending[:i], b.interval), complete); err != nil {
+			return err
+		}
+		pending = pending[i:]
+		if done {
+			return nil
+		}
+		since = last
+	}
+}
+
+// save merges candles into the store, skipping intervals with snapshots, and moves the
+// checkpoint to next.
+func (b *backfiller) save(candles []store.Candle, next time.Time) error {
+	var fresh []store.Candle
+	for _, c := range candles {
+		if !b.covered[c.Time.Unix()] {
+			fresh = append(fresh, c)
+		}
+	}
+	added, err := b.store.MergeCandles(b.pair, b.interval, fresh)
+	if err != nil {
+		return err
+	}
+	if next.After(b.cp.Next) {
+		b.log.Infof("saved %d candles from %s to %s", added, b.cp.Next.Format(time.RFC3339), next.Format(time.RFC3339))
+	}
+	b.cp.Next = next
+	b.cp.Added += added
+	return b.saveCheckpoint()
+}
+
+// candlesFromTrades groups trades, which must be in time order, into candles of interval
+// aligned to UTC midnight. Intervals without trades have no candle.
+func candlesFromTrades(pair string, trades []kraken.Trade, interval time.Duration) []store.Candle {
+	var (
+		candles []store.Candle
+		// volume is summed exactly, adding up floats turns 60 trades of 0.01 into
+		// 0.6000000000000003
+		volume decimal.Decimal
+	)
+	for _, t := range trades {
+		price := t.Price.Float64()
+		start := t.Time.UTC().Truncate(interval)
+		if len(candles) == 0 || !candles[len(candles)-1].Time.Equal(start) {
+			candles = append(candles, store.Candle{Time: start, Pair: pair, Open: price, High: price, Low: price})
+			volume = decimal.Decimal{}
+		}
+		c := &candles[len(candles)-1]
+		if price > c.High {
+			c.High = price
+		}
+		if price < c.Low {
+			c.Low = price
+		}
+		c.Close = price
+		volume = volume.Add(t.Volume)
+		c.Volume = volume.Float64()
+	}
+	return candles
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/kraken/krakentest"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+var backfillStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(hours, minutes int) time.Time {
+	return backfillStart.Add(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute)
+}
+
+// fakeHistory serves trades a page at a time from the Trades endpoint and candles from
+// the OHLC endpoint, like Kraken only serving candles from 03:00.
+type fakeHistory struct {
+	*krakentest.Server
+	pageSize int
+
+	mu sync.Mutex
+	// onTrades is called before the nth Trades request is answered.
+	onTrades func(n int)
+	requests int
+}
+
+func newFakeHistory(t *testing.T) *fakeHistory {
+	trade := func(at time.Time, price, volume string) kraken.Trade {
+		return kraken.Trade{Time: at, Price: decimal.Must(price), Volume: decimal.Must(volume), Side: "b", OrderType: "m"}
+	}
+	trades := []kraken.Trade{
+		trade(at(0, 10), "100", "0.1"),
+		trade(at(0, 50), "110", "0.2"),
+		// the first page ends inside the 01:00 interval
+		trade(at(1, 10), "120", "0.3"),
+		trade(at(1, 40), "90", "0.4"),
+		trade(at(2, 20), "130", "0.5"),
+		trade(at(2, 30), "140", "0.6"),
+		trade(at(3, 15), "150", "0.7"),
+		trade(at(4, 5), "160", "0.8"),
+	}
+	candles := []kraken.Candle{
+		{Time: at(3, 0), Open: decimal.Must("150"), High: decimal.Must("155"), Low: decimal.Must("149"), Close: decimal.Must("152"), Volume: decimal.Must("1.5")},
+		{Time: at(4, 0), Open: decimal.Must("152"), High: decimal.Must("160"), Low: decimal.Must("152"), Close: decimal.Must("160"), Volume: decimal.Must("0.8")},
+	}
+
+	f := &fakeHistory{Server: krakentest.NewServer(), pageSize: 3}
+	t.Cleanup(f.Close)
+	f.Handle("Trades", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests++
+		if f.onTrades != nil {
+			f.onTrades(f.requests)
+		}
+		f.mu.Unlock()
+
+		since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		var page []kraken.Trade
+		last := since
+		for _, t := range trades {
+			if t.Time.UnixNano() > since && len(page) < f.pageSize {
+				page = append(page, t)
+				last = t.Time.UnixNano()
+			}
+		}
+		krakentest.WriteResult(w, map[string]interface{}{"XXBTZUSD": page, "last": strconv.FormatInt(last, 10)})
+	})
+	f.Handle("OHLC", func(w http.ResponseWriter, r *http.Request) {
+		since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		var page []kraken.Candle
+		for _, c := range candles {
+			if c.Time.Unix() > since {
+				page = append(page, c)
+			}
+		}
+		krakentest.WriteResult(w, map[string]interface{}{"XXBTZUSD": page, "last": candles[len(candles)-1].Time.Unix()})
+	})
+	return f
+}
+
+// newBackfiller backfills 00:00 to 04:00 in hourly candles into dir, 02:00 is covered by
+// snapshots.
+func newBackfiller(t *testing.T, f *fakeHistory, dir string) *backfiller {
+	st, err := store.Open(filepath.Join(dir, "ticker"), store.CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &backfiller{
+		log:            zap.NewNop().Sugar(),
+		client:         kraken.NewClient(kraken.WithBaseURL(f.URL)),
+		store:          st,
+		pair:           "XXBTZUSD",
+		interval:       time.Hour,
+		to:             at(4, 0),
+		covered:        map[int64]bool{at(2, 0).Unix(): true},
+		checkpointFile: filepath.Join(dir, "backfill", "XXBTZUSD-1h.json"),
+	}
+	if err = b.loadCheckpoint(at(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func savedCandles(t *testing.T, b *backfiller) string {
+	t.Helper()
+	candles, err := b.store.Candles(b.pair, b.interval, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	for _, c := range candles {
+		s += fmt.Sprintf("%s %v %v %v %v %v\n", c.Time.Format("15:04"), c.Open, c.High, c.Low, c.Close, c.Volume)
+	}
+	return s
+}
+
+// wantCandles are built from trades until 03:00, where the OHLC endpoint takes over. The
+// 01:00 candle has trades from two pages and 02:00 is left to the snapshots.
+const wantCandles = `00:00 100 110 100 110 0.3
+01:00 120 120 90 90 0.7
+03:00 150 155 149 152 1.5
+`
+
+func TestBackfill(t *testing.T) {
+	f := newFakeHistory(t)
+	b := newBackfiller(t, f, t.TempDir())
+	if err := b.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := savedCandles(t, b); got != wantCandles {
+		t.Errorf("got candles\n%s\nwant\n%s", got, wantCandles)
+	}
+	if b.cp.Added != 3 || !b.cp.Next.Equal(at(4, 0)) {
+		t.Errorf("got checkpoint %+v, want 3 added up to 04:00", b.cp)
+	}
+}
+
+func TestBackfillResume(t *testing.T) {
+	f := newFakeHistory(t)
+	dir := t.TempDir()
+	b := newBackfiller(t, f, dir)
+
+	// interrupt the backfill while the second page of trades is requested
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f.onTrades = func(n int) {
+		if n == 2 {
+			cancel()
+		}
+	}
+	if err := b.run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	// only the interval which ended on the first page is saved, 01:00 continues on the
+	// second page
+	if got, want := savedCandles(t, b), "00:00 100 110 100 110 0.3\n"; got != want {
+		t.Errorf("got candles after interrupting\n%s\nwant\n%s", got, want)
+	}
+
+	f.onTrades = nil
+	b = newBackfiller(t, f, dir)
+	if !b.cp.Next.Equal(at(1, 0)) || b.cp.Added != 1 {
+		t.Fatalf("got checkpoint %+v, want to resume from 01:00 with 1 added", b.cp)
+	}
+	if err := b.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := savedCandles(t, b); got != wantCandles {
+		t.Errorf("got candles\n%s\nwant\n%s", got, wantCandles)
+	}
+	if b.cp.Added != 3 {
+		t.Errorf("got %d candles added, want 3", b.cp.Added)
+	}
+}
+
+func TestBackfillTwice(t *testing.T) {
+	f := newFakeHistory(t)
+	dir := t.TempDir()
+	b := newBackfiller(t, f, dir)
+	if err := b.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a finished backfill removes its checkpoint, so a second run starts over and finds
+	// every interval already saved
+	b = newBackfiller(t, f, dir)
+	b.cp.Next, b.cp.Added = at(0, 0), 0
+	if err := b.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if b.cp.Added != 0 {
+		t.Errorf("second run added %d candles, want 0", b.cp.Added)
+	}
+	if got := savedCandles(t, b); got != wantCandles {
+		t.Errorf("got candles\n%s\nwant\n%s", got, wantCandles)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/alert"
+	"github.com/1gm/x/kraken-ticker/exchange"
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/orderbook"
+	"github.com/1gm/x/kraken-ticker/snapshot"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+// collector fetches and saves ticker snapshots, one call to poll per interval.
+type collector struct {
+	log      *zap.SugaredLogger
+	exchange exchange.Exchange
+	// client fetches order books, which are only saved for Kraken.
+	client *kraken.Client
+	store  *store.Store
+	// snapshots is nil unless -raw is set, it archives every unparsed response.
+	snapshots *snapshot.Writer
+	// guard pauses saving raw responses when disk space is low, nil when disabled.
+	guard *diskGuard
+	// requested are the pairs passed to the Ticker endpoint, empty for every pair.
+	requested []string
+	// tracked are the pairs summarized after each poll.
+	tracked []string
+	summary *template.Template
+
+	retries int
+	backoff backoff
+	breaker *circuitBreaker
+	gaps    *gapTracker
+	alerts  *alert.Engine
+	// books is nil unless order books are saved, bookDepth is the number of levels fetched.
+	books     *orderbook.Store
+	bookDepth int
+	// metrics is nil unless -metrics is set.
+	metrics *exporter
+	// portfolio is nil unless -holdings is set.
+	portfolio *valuer
+}
+
+// poll fetches and saves the snapshot for the interval scheduled at scheduled. Fetch
+// failures are retried and recorded as gaps, only errors which should stop the collector
+// are returned.
+func (c *collector) poll(ctx context.Context, scheduled time.Time) error {
+	if !c.breaker.allow(time.Now()) {
+		c.log.Warn("circuit breaker open, skipping poll")
+		c.gaps.miss(scheduled, "circuit breaker open")
+		c.metrics.missed()
+		return nil
+	}
+
+	c.log.Info("fetching rates at ", scheduled.UTC().Format(time.RFC3339))
+
+	// the unparsed response is only needed for -raw and only some exchanges have one
+	rawQuoter, _ := c.exchange.(exchange.RawQuoter)
+	if c.snapshots == nil {
+		rawQuoter = nil
+	}
+	var (
+		quotes []exchange.Quote
+		raw    []byte
+	)
+	err := retry(ctx, c.retries, c.backoff, func(ctx context.Context) (err error) {
+		start := time.Now()
+		if rawQuoter != nil {
+			quotes, raw, err = rawQuoter.QuotesRaw(ctx, c.requested...)
+		} else {
+			quotes, err = c.exchange.Quotes(ctx, c.requested...)
+		}
+		c.metrics.fetched(time.Since(start), err)
+		return err
+	}, func(attempt int, delay time.Duration, err error) {
+		c.log.Warnf("fetch failed, retry %d/%d in %s: %v", attempt, c.retries, delay.Round(time.Millisecond), err)
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	} else if err != nil {
+		c.log.Error("failed to fetch rates: ", err)
+		c.gaps.miss(scheduled, err.Error())
+		c.metrics.missed()
+		if c.breaker.failure(time.Now()) {
+			c.log.Warnf("%d consecutive polls failed, pausing for %s", c.breaker.failures, c.breaker.cooldown)
+			c.metrics.breaker(true)
+		}
+		return nil
+	}
+
+	c.breaker.success()
+	c.metrics.breaker(false)
+	if gap, err := c.gaps.ok(); err != nil {
+		c.log.Error("failed to record gap: ", err)
+	} else if gap != nil {
+		c.metrics.gap()
+		c.log.Warnf("recovered after missing %d polls since %s", gap.Missed, gap.From.UTC().Format(time.RFC3339))
+	}
+
+	// records are stamped to the second, matching the names of raw response files, so
+	// query can tell a snapshot saved both ways apart from two separate snapshots
+	at := scheduled.Truncate(time.Second)
+	records := make([]store.Record, 0, len(quotes))
+	byPair := make(map[string]exchange.Quote, len(quotes))
+	for _, q := range quotes {
+		records = append(records, recordFromQuote(at, q))
+		byPair[q.Pair] = q
+	}
+	c.log.Infof("saving %d records to %s", len(records), c.store.Dir())
+	if err = c.store.Append(records...); err != nil {
+		return fmt.Errorf("failed to save records: %v", err)
+	}
+	c.metrics.observe(records...)
+	if c.alerts != nil {
+		c.alerts.Evaluate(records...)
+	}
+	c.portfolio.observe(records...)
+	if err = c.portfolio.save(at); err != nil {
+		return err
+	}
+
+	if rawQuoter != nil {
+		allowed := c.guard.allow(c.log)
+		c.metrics.rawPaused(!allowed)
+		if allowed {
+			filename, err := c.snapshots.Write(scheduled, raw)
+			if err != nil {
+				return fmt.Errorf("failed to save raw response: %v", err)
+			}
+			c.log.Info("saved raw response to ", filename)
+		}
+	}
+
+	for _, pair := range c.tracked {
+		q, ok := byPair[pair]
+		if !ok {
+			c.log.Warnf("%s missing from ticker response", pair)
+			continue
+		}
+		line, err := summarize(c.summary, q)
+		if err != nil {
+			c.log.Errorf("failed to summarize %s: %v", pair, err)
+			continue
+		}
+		c.log.Info(line)
+	}
+
+	if c.books != nil {
+		return c.pollBooks(ctx, scheduled)
+	}
+	return nil
+}
+
+// pollBooks saves the order book of every tracked pair, pairs whose book cannot be
+// fetched are skipped.
+func (c *collector) pollBooks(ctx context.Context, scheduled time.Time) error {
+	at := scheduled.Truncate(time.Second)
+	var snapshots []orderbook.Snapshot
+	for _, pair := range c.tracked {
+		var book kraken.Book
+		err := retry(ctx, c.retries, c.backoff, func(ctx context.Context) (err error) {
+			book, err = c.client.Depth(ctx, pair, c.bookDepth)
+			return err
+		}, func(attempt int, delay time.Duration, err error) {
+			c.log.Warnf("%s book fetch failed, retry %d/%d in %s: %v", pair, attempt, c.retries, delay.Round(time.Millisecond), err)
+		})
+		if errors.Is(err, context.Canceled) {
+			return nil
+		} else if err != nil {
+			c.log.Errorf("failed to fetch %s book: %v", pair, err)
+			continue
+		}
+		snapshots = append(snapshots, orderbook.FromDepth(at, pair, book))
+	}
+
+	metrics, err := c.books.Append(snapshots...)
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		logBookMetrics(c.log, m)
+	}
+	return nil
+}
+
+func logBookMetrics(log *zap.SugaredLogger, m orderbook.Metrics) {
+	log.Infof("%s book spread=%v (%.2f bps) depth(1%%)=%v/%v depth(2%%)=%v/%v imbalance=%+.2f",
+		m.Pair, m.Spread, m.SpreadBps, m.BidDepth1, m.AskDepth1, m.BidDepth2, m.AskDepth2, m.Imbalance)
+}
+
+// recordFromQuote converts a Quote into a store.Record stamped at t.
+func recordFromQuote(t time.Time, q exchange.Quote) store.Record {
+	return store.Record{
+		Time:        t.UTC(),
+		Pair:        q.Pair,
+		Ask:         q.Ask,
+		Bid:         q.Bid,
+		Last:        q.Last,
+		LastVolume:  q.LastVolume,
+		VolumeToday: q.VolumeToday,
+		Volume24h:   q.Volume24h,
+		VWAPToday:   q.VWAPToday,
+		VWAP24h:     q.VWAP24h,
+		Low24h:      q.Low24h,
+		High24h:     q.High24h,
+		Open:        q.Open,
+		TradesToday: q.TradesToday,
+		Trades24h:   q.Trades24h,
+	}
+}
@@ -0,0 +1,245 @@
+// Package decimal implements exact decimal numbers for the prices and volumes exchanges
+// send as decimal strings.
+package decimal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an exact decimal number, exchanges send prices and volumes as decimal strings
+// which cannot always be represented as a float64. The zero value is 0.
+//
+// A Decimal keeps the number of digits after the decimal point it was parsed with, so
+// "1.50" formats as "1.50". Operations never modify their operands.
+type Decimal struct {
+	// coef is the value multiplied by 10^scale, nil means 0.
+	coef  *big.Int
+	scale int32
+}
+
+// New returns coef * 10^-scale, e.g. New(150, 2) is 1.50.
+func New(coef int64, scale int32) Decimal {
+	return normalize(big.NewInt(coef), scale)
+}
+
+// Parse parses a decimal number such as "-12.345" or "1.2e-5".
+func Parse(s string) (Decimal, error) {
+	mantissa, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.ParseInt(s[i+1:], 10, 32); err != nil {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+		mantissa = s[:i]
+	}
+
+	whole, frac, _ := strings.Cut(mantissa, ".")
+	digits := whole + frac
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		digits = digits[1:]
+	}
+	if digits == "" || strings.Trim(digits, "0123456789") != "" || strings.ContainsAny(frac, "+-") {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	coef, ok := new(big.Int).SetString(whole+frac, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	scale := int64(len(frac)) - exp
+	if scale > 1<<20 || scale < -(1<<20) {
+		return Decimal{}, fmt.Errorf("decimal %q out of range", s)
+	}
+	return normalize(coef, int32(scale)), nil
+}
+
+// Must is Parse but panics if s is invalid.
+func Must(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func (d Decimal) int() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// rescale returns d's coefficient at the larger scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.int()
+	}
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+func maxScale(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Scale returns the number of digits after the decimal point.
+func (d Decimal) Scale() int32 { return d.scale }
+
+// Coefficient returns d without its decimal point, i.e. d * 10^Scale, so New(c.Int64(),
+// d.Scale()) is d when c fits in an int64.
+func (d Decimal) Coefficient() *big.Int { return new(big.Int).Set(d.int()) }
+
+// Sign returns -1, 0 or 1.
+func (d Decimal) Sign() int { return d.int().Sign() }
+
+// IsZero reports whether d is 0.
+func (d Decimal) IsZero() bool { return d.Sign() == 0 }
+
+// Cmp returns -1, 0 or 1 if d is less than, equal to or greater than y.
+func (d Decimal) Cmp(y Decimal) int {
+	scale := maxScale(d.scale, y.scale)
+	return d.rescale(scale).Cmp(y.rescale(scale))
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Add returns d + y.
+func (d Decimal) Add(y Decimal) Decimal {
+	scale := maxScale(d.scale, y.scale)
+	return Decimal{coef: new(big.Int).Add(d.rescale(scale), y.rescale(scale)), scale: scale}
+}
+
+// Sub returns d - y.
+func (d Decimal) Sub(y Decimal) Decimal {
+	scale := maxScale(d.scale, y.scale)
+	return Decimal{coef: new(big.Int).Sub(d.rescale(scale), y.rescale(scale)), scale: scale}
+}
+
+// Mul returns d * y.
+func (d Decimal) Mul(y Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.int(), y.int()), scale: d.scale + y.scale}
+}
+
+// Quo returns d / y rounded to scale digits after the decimal point, see Round. Quo
+// panics if y is 0.
+func (d Decimal) Quo(y Decimal, scale int32) Decimal {
+	if y.IsZero() {
+		panic("decimal: division by zero")
+	}
+	// d/y = (d.coef * 10^y.scale) / (y.coef * 10^d.scale)
+	num := new(big.Int).Mul(d.int(), pow10(y.scale))
+	den := new(big.Int).Mul(y.int(), pow10(d.scale))
+	if scale < 0 {
+		return quoRound(num, den.Mul(den, pow10(-scale)), scale)
+	}
+	return quoRound(num.Mul(num, pow10(scale)), den, scale)
+}
+
+// Round returns d rounded to places digits after the decimal point, halves are rounded
+// away from zero. The result always has exactly places digits, so Round can also pad,
+// e.g. 1.5 rounded to 2 places is 1.50. Negative places round to the left of the decimal
+// point and leave no digits after it, e.g. 1250 rounded to -2 places is 1300.
+func (d Decimal) Round(places int32) Decimal {
+	if places >= d.scale {
+		return Decimal{coef: d.rescale(places), scale: places}
+	}
+	return quoRound(d.int(), pow10(d.scale-places), places)
+}
+
+// Truncate returns d with digits after places removed, i.e. rounded towards zero. Like
+// Round, negative places truncate to the left of the decimal point.
+func (d Decimal) Truncate(places int32) Decimal {
+	if places >= d.scale {
+		return Decimal{coef: d.rescale(places), scale: places}
+	}
+	return normalize(new(big.Int).Quo(d.int(), pow10(d.scale-places)), places)
+}
+
+// normalize returns coef * 10^-scale with a scale of at least 0, as String requires.
+func normalize(coef *big.Int, scale int32) Decimal {
+	if scale < 0 {
+		return Decimal{coef: coef.Mul(coef, pow10(-scale))}
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// quoRound returns num/den as a Decimal with the given scale, halves are rounded away
+// from zero. A negative scale rounds to a multiple of 10^-scale.
+func quoRound(num, den *big.Int, scale int32) Decimal {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() != 0 {
+		// |2r| >= |den| means the remainder is at least half
+		twice := new(big.Int).Abs(r)
+		twice.Lsh(twice, 1)
+		if twice.Cmp(new(big.Int).Abs(den)) >= 0 {
+			if num.Sign()*den.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	return normalize(q, scale)
+}
+
+// Float64 returns the float64 nearest to d.
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.int(), pow10(d.scale)).Float64()
+	return f
+}
+
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale == 0 {
+		return sign + digits
+	}
+	if n := int(d.scale) + 1 - len(digits); n > 0 {
+		digits = strings.Repeat("0", n) + digits
+	}
+	point := len(digits) - int(d.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// MarshalJSON encodes d as a string, as exchanges send them.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON decodes a decimal from a JSON string or number, null leaves d unchanged.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	var s string
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	} else {
+		s = string(b)
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
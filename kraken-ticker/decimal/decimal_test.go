@@ -0,0 +1,48 @@
+package decimal
+
+import "testing"
+
+func TestDecimalRound(t *testing.T) {
+	for _, tt := range []struct {
+		d            string
+		places       int32
+		round, trunc string
+	}{
+		{"1.25", 1, "1.3", "1.2"},
+		{"-1.25", 1, "-1.3", "-1.2"},
+		{"1.5", 2, "1.50", "1.50"},
+		{"1250", -2, "1300", "1200"},
+		{"-1250", -2, "-1300", "-1200"},
+		{"1249.99", -2, "1200", "1200"},
+		{"12.5", -1, "10", "10"},
+		{"15", -1, "20", "10"},
+		{"49", -2, "0", "0"},
+		{"50", -2, "100", "0"},
+	} {
+		d := Must(tt.d)
+		if got := d.Round(tt.places).String(); got != tt.round {
+			t.Errorf("%s.Round(%d) = %s, want %s", tt.d, tt.places, got, tt.round)
+		}
+		if got := d.Truncate(tt.places).String(); got != tt.trunc {
+			t.Errorf("%s.Truncate(%d) = %s, want %s", tt.d, tt.places, got, tt.trunc)
+		}
+	}
+}
+
+func TestDecimalQuo(t *testing.T) {
+	for _, tt := range []struct {
+		d, y  string
+		scale int32
+		want  string
+	}{
+		{"1", "3", 4, "0.3333"},
+		{"2", "3", 0, "1"},
+		{"1450", "1", -2, "1500"},
+		{"14.5", "1", -1, "10"},
+		{"-3000", "2", -3, "-2000"},
+	} {
+		if got := Must(tt.d).Quo(Must(tt.y), tt.scale).String(); got != tt.want {
+			t.Errorf("%s.Quo(%s, %d) = %s, want %s", tt.d, tt.y, tt.scale, got, tt.want)
+		}
+	}
+}
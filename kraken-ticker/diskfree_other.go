@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!dragonfly,!windows
+
+package main
+
+// freeSpace is not implemented on this platform, so -min-free-mb is ignored.
+func freeSpace(dir string) (uint64, error) {
+	return 0, errFreeSpaceUnsupported
+}
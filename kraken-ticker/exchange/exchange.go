@@ -0,0 +1,123 @@
+// Package exchange is a common interface to the public market data of exchanges, so the
+// collector can poll, store and alert on any exchange with a provider. Prices and volumes
+// are exact decimals, pairs are identified by the exchange's own key and mapped to a
+// common BASE/QUOTE symbol, e.g. Kraken's XXBTZUSD is BTC/USD.
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+)
+
+// Exchange is a provider of market data.
+type Exchange interface {
+	// Name is the provider name, e.g. kraken.
+	Name() string
+	// Pairs returns every pair traded on the exchange.
+	Pairs(ctx context.Context) ([]Pair, error)
+	// Quotes fetches the latest quote of each of pairs, given by key, or of every pair when
+	// pairs is empty.
+	Quotes(ctx context.Context, pairs ...string) ([]Quote, error)
+	// StreamTrades calls fn with every trade of pairs, given by key, until ctx is done or
+	// the stream fails.
+	StreamTrades(ctx context.Context, pairs []string, fn func(Trade)) error
+}
+
+// RawQuoter is implemented by exchanges which fetch every quote in a single response,
+// QuotesRaw works like Quotes but also returns the unparsed response so it can be saved.
+type RawQuoter interface {
+	QuotesRaw(ctx context.Context, pairs ...string) ([]Quote, []byte, error)
+}
+
+// Pair is a pair traded on an exchange.
+type Pair struct {
+	// Key is the exchange's name for the pair, e.g. XXBTZUSD, used to store its records.
+	Key string `json:"key"`
+	// Symbol is BASE/QUOTE in common asset codes, e.g. BTC/USD.
+	Symbol string `json:"symbol"`
+	Base   string `json:"base"`
+	Quote  string `json:"quote"`
+	// Aliases are other names of the pair, e.g. Kraken's altname XBTUSD.
+	Aliases []string `json:"aliases,omitempty"`
+	// PriceDecimals and VolumeDecimals are the precision of prices and volumes.
+	PriceDecimals  int32 `json:"price_decimals"`
+	VolumeDecimals int32 `json:"volume_decimals"`
+}
+
+// Quote is a ticker of a pair, values an exchange does not report are zero.
+type Quote struct {
+	Time   time.Time `json:"time"`
+	Pair   string    `json:"pair"`
+	Symbol string    `json:"symbol"`
+
+	Bid        decimal.Decimal `json:"bid"`
+	Ask        decimal.Decimal `json:"ask"`
+	Last       decimal.Decimal `json:"last"`
+	LastVolume decimal.Decimal `json:"last_volume"`
+	Open       decimal.Decimal `json:"open"`
+	Low24h     decimal.Decimal `json:"low_24h"`
+	High24h    decimal.Decimal `json:"high_24h"`
+	Volume24h  decimal.Decimal `json:"volume_24h"`
+	VWAP24h    decimal.Decimal `json:"vwap_24h"`
+	Trades24h  int64           `json:"trades_24h"`
+	// VolumeToday, VWAPToday and TradesToday cover the current UTC day, only some
+	// exchanges report them.
+	VolumeToday decimal.Decimal `json:"volume_today"`
+	VWAPToday   decimal.Decimal `json:"vwap_today"`
+	TradesToday int64           `json:"trades_today"`
+
+	// Native is the exchange's own ticker, e.g. a kraken.Ticker.
+	Native interface{} `json:"-"`
+}
+
+// Trade is a single trade of a pair.
+type Trade struct {
+	Time   time.Time `json:"time"`
+	Pair   string    `json:"pair"`
+	Symbol string    `json:"symbol"`
+	// Side is buy or sell, the side of the order which took liquidity.
+	Side   string          `json:"side"`
+	Price  decimal.Decimal `json:"price"`
+	Volume decimal.Decimal `json:"volume"`
+}
+
+// Resolve maps each of names to the key of one of pairs, e.g. XBTUSD, XBT/USD, BTC/USD
+// and btcusd all resolve to Kraken's XXBTZUSD. Names are matched case insensitively
+// against each pair's key, symbol and aliases, with and without the '/'.
+func Resolve(pairs []Pair, names []string) (map[string]string, error) {
+	index := make(map[string]string)
+	// keys are added last so they win over a symbol or alias of another pair
+	for _, p := range pairs {
+		for _, name := range append([]string{p.Symbol}, p.Aliases...) {
+			if name != "" {
+				index[normalize(name)] = p.Key
+			}
+		}
+	}
+	for _, p := range pairs {
+		index[normalize(p.Key)] = p.Key
+	}
+
+	resolved := make(map[string]string, len(names))
+	var unknown []string
+	for _, name := range names {
+		key, ok := index[normalize(name)]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		resolved[name] = key
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown pairs: %s", strings.Join(unknown, ", "))
+	}
+	return resolved, nil
+}
+
+func normalize(name string) string {
+	return strings.ReplaceAll(strings.ToUpper(strings.TrimSpace(name)), "/", "")
+}
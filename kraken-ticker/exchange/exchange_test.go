@@ -0,0 +1,30 @@
+package exchange
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	pairs := []Pair{
+		{Key: "XXBTZUSD", Symbol: "BTC/USD", Aliases: []string{"XBTUSD", "XBT/USD"}},
+		{Key: "XETHZEUR", Symbol: "ETH/EUR", Aliases: []string{"ETHEUR", "ETH/EUR"}},
+		// a key which is also another pair's alias resolves to the pair with the key
+		{Key: "ETHEUR", Symbol: "ETH/EUR.d"},
+	}
+	names := []string{"XXBTZUSD", "XBTUSD", "XBT/USD", "BTC/USD", "btcusd", " btc/usd ", "ETH/EUR", "etheur"}
+	got, err := Resolve(pairs, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"XXBTZUSD": "XXBTZUSD", "XBTUSD": "XXBTZUSD", "XBT/USD": "XXBTZUSD", "BTC/USD": "XXBTZUSD",
+		"btcusd": "XXBTZUSD", " btc/usd ": "XXBTZUSD", "ETH/EUR": "ETHEUR", "etheur": "ETHEUR",
+	}
+	for name, key := range want {
+		if got[name] != key {
+			t.Errorf("Resolve(%q) = %q, want %q", name, got[name], key)
+		}
+	}
+
+	if _, err = Resolve(pairs, []string{"BTC/USD", "DOGE/USD", "nope"}); err == nil || err.Error() != "unknown pairs: DOGE/USD, nope" {
+		t.Errorf("Resolve() = %v, want the unknown pairs", err)
+	}
+}
@@ -0,0 +1,203 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/kraken/ws"
+)
+
+// krakenAssets maps the asset codes Kraken uses to common codes.
+var krakenAssets = map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+}
+
+// KrakenSymbol converts the websocket name of a Kraken pair, e.g. XBT/USD, to a symbol
+// with common asset codes, e.g. BTC/USD, as used by the WebSocket v2 API.
+func KrakenSymbol(wsname string) string {
+	base, quote, ok := strings.Cut(wsname, "/")
+	if !ok {
+		return wsname
+	}
+	if common, ok := krakenAssets[base]; ok {
+		base = common
+	}
+	if common, ok := krakenAssets[quote]; ok {
+		quote = common
+	}
+	return base + "/" + quote
+}
+
+// KrakenQuote converts the Ticker of the pair key, whose symbol may be empty, to a Quote.
+func KrakenQuote(t time.Time, key, symbol string, ticker kraken.Ticker) Quote {
+	return Quote{
+		Time:        t,
+		Pair:        key,
+		Symbol:      symbol,
+		Bid:         ticker.Bid.Price,
+		Ask:         ticker.Ask.Price,
+		Last:        ticker.Close.Price,
+		LastVolume:  ticker.Close.LotVolume,
+		Open:        ticker.OpeningPrice,
+		Low24h:      ticker.Low.Last24Hours,
+		High24h:     ticker.High.Last24Hours,
+		Volume24h:   ticker.Volume.Last24Hours,
+		VWAP24h:     ticker.VWAP.Last24Hours,
+		Trades24h:   int64(ticker.Trades.Last24Hours),
+		VolumeToday: ticker.Volume.Today,
+		VWAPToday:   ticker.VWAP.Today,
+		TradesToday: int64(ticker.Trades.Today),
+		Native:      ticker,
+	}
+}
+
+// Kraken is the Exchange for Kraken's REST and WebSocket v2 APIs.
+type Kraken struct {
+	client *kraken.Client
+	ws     *ws.Client
+	// events receives the Gap and Error callbacks of the trade stream.
+	events ws.Handler
+
+	mu    sync.Mutex
+	pairs map[string]Pair
+}
+
+// KrakenOption configures a Kraken exchange.
+type KrakenOption func(*Kraken)
+
+// WithWebSocket streams trades with c. The Gap and Error callbacks of events are called
+// for the trade stream, see ws.Handler, its other callbacks are ignored.
+func WithWebSocket(c *ws.Client, events ws.Handler) KrakenOption {
+	return func(k *Kraken) {
+		k.ws, k.events = c, events
+	}
+}
+
+// NewKraken creates a Kraken exchange, overriding the defaults with the input options. By
+// default trades are streamed from ws.DefaultURL without reporting gaps or errors.
+func NewKraken(client *kraken.Client, opts ...KrakenOption) *Kraken {
+	k := &Kraken{client: client}
+	for _, opt := range opts {
+		opt(k)
+	}
+	if k.ws == nil {
+		k.ws = ws.NewClient()
+	}
+	return k
+}
+
+func (k *Kraken) Name() string { return "kraken" }
+
+// Pairs returns every pair from the AssetPairs endpoint. Pairs without a websocket name,
+// e.g. dark pool pairs, keep Kraken's asset codes in their symbol.
+func (k *Kraken) Pairs(ctx context.Context) ([]Pair, error) {
+	assetPairs, err := k.client.AssetPairs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get asset pairs: %w", err)
+	}
+
+	pairs := make([]Pair, 0, len(assetPairs))
+	byKey := make(map[string]Pair, len(assetPairs))
+	for key, ap := range assetPairs {
+		p := Pair{
+			Key:            key,
+			Symbol:         ap.Base + "/" + ap.Quote,
+			Aliases:        []string{ap.Altname},
+			PriceDecimals:  int32(ap.PairDecimals),
+			VolumeDecimals: int32(ap.LotDecimals),
+		}
+		if ap.WSName != "" {
+			p.Symbol = KrakenSymbol(ap.WSName)
+			p.Aliases = append(p.Aliases, ap.WSName)
+		}
+		p.Base, p.Quote, _ = strings.Cut(p.Symbol, "/")
+		pairs = append(pairs, p)
+		byKey[key] = p
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+
+	k.mu.Lock()
+	k.pairs = byKey
+	k.mu.Unlock()
+	return pairs, nil
+}
+
+// pair returns the pair with key, fetching the pairs on first use.
+func (k *Kraken) pair(ctx context.Context, key string) (Pair, bool, error) {
+	k.mu.Lock()
+	loaded := k.pairs != nil
+	k.mu.Unlock()
+	if !loaded {
+		if _, err := k.Pairs(ctx); err != nil {
+			return Pair{}, false, err
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	p, ok := k.pairs[key]
+	return p, ok, nil
+}
+
+func (k *Kraken) Quotes(ctx context.Context, pairs ...string) ([]Quote, error) {
+	quotes, _, err := k.QuotesRaw(ctx, pairs...)
+	return quotes, err
+}
+
+// QuotesRaw fetches the Ticker endpoint, the symbols of the quotes are left empty until
+// Pairs has been called.
+func (k *Kraken) QuotesRaw(ctx context.Context, pairs ...string) ([]Quote, []byte, error) {
+	tickers, raw, err := k.client.TickerRaw(ctx, pairs...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	k.mu.Lock()
+	quotes := make([]Quote, 0, len(tickers))
+	for key, ticker := range tickers {
+		quotes = append(quotes, KrakenQuote(now, key, k.pairs[key].Symbol, ticker))
+	}
+	k.mu.Unlock()
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Pair < quotes[j].Pair })
+	return quotes, raw, nil
+}
+
+// StreamTrades subscribes to the trade channel of the WebSocket API, reconnecting until
+// ctx is done.
+func (k *Kraken) StreamTrades(ctx context.Context, pairs []string, fn func(Trade)) error {
+	keys := make(map[string]string, len(pairs))
+	symbols := make([]string, 0, len(pairs))
+	for _, key := range pairs {
+		p, ok, err := k.pair(ctx, key)
+		if err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("unknown pair %s", key)
+		}
+		keys[p.Symbol] = key
+		symbols = append(symbols, p.Symbol)
+	}
+
+	sub := ws.Subscription{Channel: ws.ChannelTrade, Symbols: symbols}
+	return k.ws.Run(ctx, []ws.Subscription{sub}, ws.Handler{
+		Trade: func(t ws.Trade) {
+			fn(Trade{
+				Time:   t.Timestamp,
+				Pair:   keys[t.Symbol],
+				Symbol: t.Symbol,
+				Side:   t.Side,
+				Price:  t.Price,
+				Volume: t.Qty,
+			})
+		},
+		Gap:   k.events.Gap,
+		Error: k.events.Error,
+	})
+}
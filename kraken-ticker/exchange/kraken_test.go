@@ -0,0 +1,222 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/kraken/krakentest"
+	"github.com/1gm/x/kraken-ticker/kraken/ws"
+)
+
+const testAssetPairs = `{
+	"XXBTZUSD": {"altname": "XBTUSD", "wsname": "XBT/USD", "base": "XXBT", "quote": "ZUSD", "pair_decimals": 1, "lot_decimals": 8},
+	"XETHZEUR": {"altname": "ETHEUR", "wsname": "ETH/EUR", "base": "XETH", "quote": "ZEUR", "pair_decimals": 2, "lot_decimals": 8},
+	"XXBTZUSD.d": {"altname": "XBTUSD.d", "base": "XXBT", "quote": "ZUSD", "pair_decimals": 1, "lot_decimals": 8}
+}`
+
+const testTicker = `{
+	"XXBTZUSD": {
+		"a": ["30300.10000", "1", "1.000"],
+		"b": ["30300.00000", "2", "2.000"],
+		"c": ["30303.20000", "0.00067643"],
+		"v": ["4083.67001100", "4412.73601799"],
+		"p": ["30706.77771", "30689.13205"],
+		"t": [34619, 38907],
+		"l": ["29868.30000", "29868.30000"],
+		"h": ["31631.00000", "31631.00000"],
+		"o": "30502.80000"
+	}
+}`
+
+func newTestKraken(t *testing.T) (*Kraken, *krakentest.Server) {
+	t.Helper()
+	server := krakentest.NewServer()
+	t.Cleanup(server.Close)
+	server.SetResult("AssetPairs", json.RawMessage(testAssetPairs))
+	server.SetResult("Ticker", json.RawMessage(testTicker))
+	return NewKraken(kraken.NewClient(kraken.WithBaseURL(server.URL))), server
+}
+
+func TestKrakenPairs(t *testing.T) {
+	k, _ := newTestKraken(t)
+	pairs, err := k.Pairs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Pair{
+		{Key: "XETHZEUR", Symbol: "ETH/EUR", Base: "ETH", Quote: "EUR", Aliases: []string{"ETHEUR", "ETH/EUR"}, PriceDecimals: 2, VolumeDecimals: 8},
+		{Key: "XXBTZUSD", Symbol: "BTC/USD", Base: "BTC", Quote: "USD", Aliases: []string{"XBTUSD", "XBT/USD"}, PriceDecimals: 1, VolumeDecimals: 8},
+		// without a websocket name the symbol keeps Kraken's asset codes
+		{Key: "XXBTZUSD.d", Symbol: "XXBT/ZUSD", Base: "XXBT", Quote: "ZUSD", Aliases: []string{"XBTUSD.d"}, PriceDecimals: 1, VolumeDecimals: 8},
+	}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Errorf("Pairs() = %+v, want %+v", pairs, want)
+	}
+}
+
+func TestKrakenQuotes(t *testing.T) {
+	k, server := newTestKraken(t)
+	ctx := context.Background()
+
+	quotes, raw, err := k.QuotesRaw(ctx, "XXBTZUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quotes) != 1 {
+		t.Fatalf("got %d quotes, want 1", len(quotes))
+	}
+	if got := server.Requests()[0].URL.Query().Get("pair"); got != "XXBTZUSD" {
+		t.Errorf("requested pair %q, want XXBTZUSD", got)
+	}
+	var resp struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err = json.Unmarshal(raw, &resp); err != nil || resp.Result["XXBTZUSD"] == nil {
+		t.Errorf("raw response %s does not hold the ticker: %v", raw, err)
+	}
+
+	q := quotes[0]
+	if q.Pair != "XXBTZUSD" || q.Symbol != "" || q.Time.IsZero() {
+		t.Errorf("got pair %q symbol %q time %s, want XXBTZUSD without a symbol before Pairs", q.Pair, q.Symbol, q.Time)
+	}
+	for name, tt := range map[string]struct {
+		got  decimal.Decimal
+		want string
+	}{
+		"Bid":         {q.Bid, "30300.00000"},
+		"Ask":         {q.Ask, "30300.10000"},
+		"Last":        {q.Last, "30303.20000"},
+		"LastVolume":  {q.LastVolume, "0.00067643"},
+		"Open":        {q.Open, "30502.80000"},
+		"Low24h":      {q.Low24h, "29868.30000"},
+		"High24h":     {q.High24h, "31631.00000"},
+		"Volume24h":   {q.Volume24h, "4412.73601799"},
+		"VWAP24h":     {q.VWAP24h, "30689.13205"},
+		"VolumeToday": {q.VolumeToday, "4083.67001100"},
+		"VWAPToday":   {q.VWAPToday, "30706.77771"},
+	} {
+		if tt.got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", name, tt.got, tt.want)
+		}
+	}
+	if q.Trades24h != 38907 || q.TradesToday != 34619 {
+		t.Errorf("got %d trades in 24h and %d today, want 38907 and 34619", q.Trades24h, q.TradesToday)
+	}
+	if _, ok := q.Native.(kraken.Ticker); !ok {
+		t.Errorf("Native is a %T, want a kraken.Ticker", q.Native)
+	}
+
+	if _, err = k.Pairs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if quotes, err = k.Quotes(ctx, "XXBTZUSD"); err != nil {
+		t.Fatal(err)
+	}
+	if quotes[0].Symbol != "BTC/USD" {
+		t.Errorf("got symbol %q after Pairs, want BTC/USD", quotes[0].Symbol)
+	}
+}
+
+func TestKrakenErrors(t *testing.T) {
+	k, server := newTestKraken(t)
+	server.SetErrors("Ticker", "EQuery:Unknown asset pair")
+	server.SetErrors("AssetPairs", "EAPI:Rate limit exceeded")
+
+	var apiErr *kraken.APIError
+	if _, err := k.Quotes(context.Background(), "NOPE"); !errors.As(err, &apiErr) || !apiErr.Has("EQuery:Unknown asset pair") {
+		t.Errorf("Quotes() = %v, want a *kraken.APIError", err)
+	}
+	// Pairs wraps the error so callers can still check for rate limits
+	if _, err := k.Pairs(context.Background()); !kraken.IsRateLimited(err) {
+		t.Errorf("Pairs() = %v, want a rate limit error", err)
+	}
+}
+
+func TestKrakenStreamTrades(t *testing.T) {
+	server := krakentest.NewServer()
+	t.Cleanup(server.Close)
+	server.SetResult("AssetPairs", json.RawMessage(testAssetPairs))
+	wsServer := krakentest.NewWSServer()
+	t.Cleanup(wsServer.Close)
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	trade := func(id int64, side, price string) map[string]interface{} {
+		return map[string]interface{}{
+			"symbol": "BTC/USD", "side": side, "price": price, "qty": "0.50000000", "ord_type": "market",
+			"trade_id": id, "timestamp": at.Add(time.Duration(id) * time.Second).Format(time.RFC3339Nano),
+		}
+	}
+	wsServer.SetSnapshot(ws.ChannelTrade, "BTC/USD", trade(1, "buy", "30000.1"))
+
+	gaps := make(chan ws.Gap, 10)
+	k := NewKraken(kraken.NewClient(kraken.WithBaseURL(server.URL)),
+		WithWebSocket(ws.NewClient(ws.WithURL(wsServer.URL)), ws.Handler{Gap: func(g ws.Gap) { gaps <- g }}))
+
+	if err := k.StreamTrades(context.Background(), []string{"NOPE"}, func(Trade) {}); err == nil || err.Error() != "unknown pair NOPE" {
+		t.Errorf("StreamTrades() = %v, want an unknown pair error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trades := make(chan Trade, 10)
+	done := make(chan error, 1)
+	go func() { done <- k.StreamTrades(ctx, []string{"XXBTZUSD"}, func(t Trade) { trades <- t }) }()
+	next := func() Trade {
+		t.Helper()
+		select {
+		case tr := <-trades:
+			return tr
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a trade")
+		}
+		return Trade{}
+	}
+
+	// trades are normalized with the pair's key and the taker's side
+	tr := next()
+	want := Trade{Time: at.Add(time.Second), Pair: "XXBTZUSD", Symbol: "BTC/USD", Side: "buy", Price: decimal.Must("30000.1"), Volume: decimal.Must("0.50000000")}
+	if !tr.Time.Equal(want.Time) || tr.Pair != want.Pair || tr.Symbol != want.Symbol || tr.Side != want.Side ||
+		tr.Price.String() != want.Price.String() || tr.Volume.String() != want.Volume.String() {
+		t.Errorf("got trade %+v, want %+v", tr, want)
+	}
+	if subs := wsServer.Subscriptions(); len(subs) != 1 || subs[0].Channel != ws.ChannelTrade || len(subs[0].Symbols) != 1 || subs[0].Symbols[0] != "BTC/USD" {
+		t.Errorf("got subscriptions %+v", subs)
+	}
+
+	// skipped trade IDs are reported to the Gap callback given to WithWebSocket
+	wsServer.Publish(ws.ChannelTrade, "update", trade(4, "sell", "29999.9"))
+	if tr = next(); tr.Side != "sell" || tr.Price.String() != "29999.9" {
+		t.Errorf("got trade %+v", tr)
+	}
+	select {
+	case g := <-gaps:
+		if g.Symbol != "BTC/USD" || g.Missed != 2 {
+			t.Errorf("got gap %+v, want 2 missed BTC/USD trades", g)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the gap")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("StreamTrades() = %v, want context.Canceled", err)
+	}
+}
+
+func TestKrakenSymbol(t *testing.T) {
+	for wsname, want := range map[string]string{
+		"XBT/USD":  "BTC/USD",
+		"XDG/XBT":  "DOGE/BTC",
+		"ETH/EUR":  "ETH/EUR",
+		"XXBTZUSD": "XXBTZUSD",
+	} {
+		if got := KrakenSymbol(wsname); got != want {
+			t.Errorf("KrakenSymbol(%q) = %q, want %q", wsname, got, want)
+		}
+	}
+}
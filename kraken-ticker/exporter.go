@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/metrics"
+	"github.com/1gm/x/kraken-ticker/store"
+)
+
+// exporter exposes the latest prices of the tracked pairs and the collector's health as
+// Prometheus metrics. Its methods do nothing on a nil exporter so callers do not need to
+// check whether -metrics is set.
+type exporter struct {
+	registry *metrics.Registry
+	tracked  map[string]bool
+
+	last      *metrics.Gauge
+	bid       *metrics.Gauge
+	ask       *metrics.Gauge
+	volume24h *metrics.Gauge
+	vwap24h   *metrics.Gauge
+	updated   *metrics.Gauge
+
+	fetchDuration *metrics.Histogram
+	fetchErrors   *metrics.Counter
+	lastSuccess   *metrics.Gauge
+	missedPolls   *metrics.Counter
+	breakerOpen   *metrics.Gauge
+	records       *metrics.Counter
+	disconnects   *metrics.Counter
+	gaps          *metrics.Counter
+	paused        *metrics.Gauge
+}
+
+func newExporter(tracked []string) *exporter {
+	r := metrics.NewRegistry()
+	e := &exporter{
+		registry: r,
+		tracked:  make(map[string]bool, len(tracked)),
+
+		last:      r.Gauge("kraken_ticker_last_price", "Price of the last trade.", "pair"),
+		bid:       r.Gauge("kraken_ticker_bid_price", "Best bid price.", "pair"),
+		ask:       r.Gauge("kraken_ticker_ask_price", "Best ask price.", "pair"),
+		volume24h: r.Gauge("kraken_ticker_volume_24h", "Volume traded in the last 24 hours.", "pair"),
+		vwap24h:   r.Gauge("kraken_ticker_vwap_24h", "Volume weighted average price of the last 24 hours.", "pair"),
+		updated:   r.Gauge("kraken_ticker_updated_timestamp_seconds", "Unix time of the latest snapshot of the pair.", "pair"),
+
+		fetchDuration: r.Histogram("kraken_ticker_fetch_duration_seconds", "Latency of Ticker requests, including failed attempts.",
+			[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}),
+		fetchErrors: r.Counter("kraken_ticker_fetch_errors_total", "Failed Ticker requests by kind: rate_limited, temporary or permanent.", "kind"),
+		lastSuccess: r.Gauge("kraken_ticker_last_success_timestamp_seconds", "Unix time of the last successful fetch or stream update."),
+		missedPolls: r.Counter("kraken_ticker_missed_polls_total", "Polls which did not save a snapshot."),
+		breakerOpen: r.Gauge("kraken_ticker_circuit_breaker_open", "1 while polling is paused by the circuit breaker."),
+		records:     r.Counter("kraken_ticker_records_saved_total", "Records saved to the store."),
+		disconnects: r.Counter("kraken_ticker_stream_disconnects_total", "WebSocket connections lost while streaming."),
+		gaps:        r.Counter("kraken_ticker_gaps_total", "Gaps recorded in gaps.jsonl."),
+		paused:      r.Gauge("kraken_ticker_raw_paused", "1 while raw responses are not saved because disk space is low."),
+	}
+	for _, pair := range tracked {
+		e.tracked[pair] = true
+	}
+	return e
+}
+
+// serve serves /metrics on ln until ctx is done.
+func (e *exporter) serve(ctx context.Context, ln net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e.registry)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// observe updates the price gauges of the tracked pairs in records.
+func (e *exporter) observe(records ...store.Record) {
+	if e == nil {
+		return
+	}
+	e.records.Add(float64(len(records)))
+	for _, r := range records {
+		if !e.tracked[r.Pair] {
+			continue
+		}
+		e.last.Set(r.Last.Float64(), r.Pair)
+		e.bid.Set(r.Bid.Float64(), r.Pair)
+		e.ask.Set(r.Ask.Float64(), r.Pair)
+		e.volume24h.Set(r.Volume24h.Float64(), r.Pair)
+		e.vwap24h.Set(r.VWAP24h.Float64(), r.Pair)
+		e.updated.Set(float64(r.Time.UnixNano())/1e9, r.Pair)
+	}
+}
+
+// fetched records a single Ticker request which took d and failed with err, if not nil.
+func (e *exporter) fetched(d time.Duration, err error) {
+	if e == nil {
+		return
+	}
+	e.fetchDuration.Observe(d.Seconds())
+	switch {
+	case err == nil:
+		e.succeeded(time.Now())
+	case errors.Is(err, context.Canceled):
+	case kraken.IsRateLimited(err):
+		e.fetchErrors.Inc("rate_limited")
+	case kraken.IsTemporary(err):
+		e.fetchErrors.Inc("temporary")
+	default:
+		e.fetchErrors.Inc("permanent")
+	}
+}
+
+func (e *exporter) succeeded(t time.Time) {
+	if e == nil {
+		return
+	}
+	e.lastSuccess.Set(float64(t.UnixNano()) / 1e9)
+}
+
+func (e *exporter) missed() {
+	if e == nil {
+		return
+	}
+	e.missedPolls.Inc()
+}
+
+func (e *exporter) breaker(open bool) {
+	if e == nil {
+		return
+	}
+	var v float64
+	if open {
+		v = 1
+	}
+	e.breakerOpen.Set(v)
+}
+
+func (e *exporter) disconnected() {
+	if e == nil {
+		return
+	}
+	e.disconnects.Inc()
+}
+
+func (e *exporter) gap() {
+	if e == nil {
+		return
+	}
+	e.gaps.Inc()
+}
+
+func (e *exporter) rawPaused(paused bool) {
+	if e == nil {
+		return
+	}
+	var v float64
+	if paused {
+		v = 1
+	}
+	e.paused.Set(v)
+}
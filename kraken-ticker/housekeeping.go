@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/orderbook"
+	"github.com/1gm/x/kraken-ticker/snapshot"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+// housekeeper archives and removes old data in the output directory once a day. Errors
+// are logged, they never stop the collector.
+type housekeeper struct {
+	log       *zap.SugaredLogger
+	directory string
+	store     *store.Store
+	// books is nil unless order books are saved.
+	books *orderbook.Store
+
+	// rollup bundles each finished day of raw responses into a daily archive.
+	rollup bool
+	// retainRaw is the number of days raw responses are kept, 0 keeps them forever.
+	retainRaw int
+	// retain is the number of days ticker and order book snapshots are kept, 0 keeps them
+	// forever. Ticker snapshots are downsampled to candles of candleInterval first.
+	retain         int
+	candleInterval time.Duration
+
+	lastRun string
+}
+
+// run does the housekeeping for now, once per UTC day. A nil housekeeper does nothing.
+func (h *housekeeper) run(now time.Time) {
+	if h == nil {
+		return
+	}
+	today := now.UTC().Format("2006-01-02")
+	if h.lastRun == today {
+		return
+	}
+	h.lastRun = today
+
+	if h.retainRaw > 0 {
+		before := now.UTC().AddDate(0, 0, -h.retainRaw).Format("2006-01-02")
+		removed, err := snapshot.Prune(h.directory, before)
+		if err != nil {
+			h.log.Error("failed to remove old raw responses: ", err)
+		} else if len(removed) > 0 {
+			h.log.Infof("removed %d raw responses and archives from before %s", len(removed), before)
+		}
+	}
+	// old days are removed first so they are not archived only to be deleted
+	if h.rollup {
+		h.archive(today)
+	}
+	if h.retain > 0 {
+		before := now.UTC().AddDate(0, 0, -h.retain).Format("2006-01-02")
+		h.downsample(before)
+		if h.books != nil {
+			removed, err := h.books.Prune(before)
+			if err != nil {
+				h.log.Error("failed to remove old order books: ", err)
+			} else if len(removed) > 0 {
+				h.log.Infof("removed %d order book files from before %s", len(removed), before)
+			}
+		}
+	}
+}
+
+// archive bundles the raw responses of every day before today.
+func (h *housekeeper) archive(today string) {
+	days, err := snapshot.Days(h.directory)
+	if err != nil {
+		h.log.Error("failed to list raw responses: ", err)
+		return
+	}
+	for _, day := range days {
+		if day >= today {
+			break
+		}
+		m, err := snapshot.Archive(h.directory, day)
+		if err != nil {
+			h.log.Error(err)
+			return
+		}
+		h.log.Infof("archived %d raw responses of %s", len(m.Files), day)
+	}
+}
+
+// downsample replaces the ticker snapshots of days before before with candles.
+func (h *housekeeper) downsample(before string) {
+	pairs, err := h.store.Pairs()
+	if err != nil {
+		h.log.Error("failed to list pairs: ", err)
+		return
+	}
+	removed := 0
+	for _, pair := range pairs {
+		days, err := h.store.Days(pair)
+		if err != nil {
+			h.log.Errorf("failed to list %s days: %v", pair, err)
+			continue
+		}
+		for _, day := range days {
+			if day >= before {
+				break
+			}
+			from, err := time.Parse("2006-01-02", day)
+			if err != nil {
+				continue
+			}
+			records, err := h.store.Query(pair, from, from.AddDate(0, 0, 1))
+			if err != nil {
+				h.log.Errorf("failed to read %s %s: %v", pair, day, err)
+				break
+			}
+			if _, err = h.store.MergeCandles(pair, h.candleInterval, store.Resample(records, h.candleInterval)); err != nil {
+				h.log.Error(err)
+				break
+			}
+			if err = h.store.RemoveDay(pair, day); err != nil {
+				h.log.Error(err)
+				break
+			}
+			removed++
+		}
+	}
+	if removed > 0 {
+		h.log.Infof("downsampled %d days of snapshots from before %s to %s candles", removed, before, store.IntervalName(h.candleInterval))
+	}
+}
+
+// errFreeSpaceUnsupported is returned by freeSpace on platforms where it cannot be checked.
+var errFreeSpaceUnsupported = errors.New("free disk space cannot be checked on " + runtime.GOOS)
+
+// diskGuard pauses saving raw responses while the free space of the output directory is
+// below minFree bytes.
+type diskGuard struct {
+	directory string
+	minFree   uint64
+	paused    bool
+}
+
+// allow reports whether raw responses can be saved, logging when saving is paused or
+// resumed. A nil diskGuard always allows saving.
+func (g *diskGuard) allow(log *zap.SugaredLogger) bool {
+	if g == nil {
+		return true
+	}
+	free, err := freeSpace(g.directory)
+	if err != nil {
+		log.Warn("failed to check free disk space: ", err)
+		return true
+	}
+	low := free < g.minFree
+	if low && !g.paused {
+		log.Warnf("%d MB free, below -min-free-mb, pausing raw responses", free>>20)
+	} else if !low && g.paused {
+		log.Infof("%d MB free, resuming raw responses", free>>20)
+	}
+	g.paused = low
+	return !low
+}
@@ -0,0 +1,118 @@
+// Package kraken is a client for Kraken's public REST API, see https://docs.kraken.com/rest/.
+package kraken
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultBaseURL is the address of Kraken's REST API.
+const DefaultBaseURL = "https://api.kraken.com"
+
+// Client makes requests to Kraken's public REST API. Use NewClient to create one.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+}
+
+// Option is a function that configures a Client.
+type Option func(*Client)
+
+// WithBaseURL sets the address requests are made to, e.g. a krakentest.Server URL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient sets the http.Client used to make requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// NewClient creates a Client, overriding the defaults with the input options. By default
+// requests are made to DefaultBaseURL using http.DefaultClient.
+func NewClient(options ...Option) *Client {
+	c := &Client{
+		baseURL:    DefaultBaseURL,
+		httpClient: http.DefaultClient,
+		userAgent:  "github.com/1gm/x/kraken-ticker",
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+type response struct {
+	Error  []string        `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+// Public calls the public endpoint, e.g. "Ticker", with params and decodes the result into
+// v. The raw response body is returned so callers can archive it.
+func (c *Client) Public(ctx context.Context, endpoint string, params url.Values, v interface{}) ([]byte, error) {
+	u := c.baseURL + "/0/public/" + endpoint
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %v", endpoint, err)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", endpoint, err)
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		res.Body.Close()
+		return nil, fmt.Errorf("failed to read %s response body: %w", endpoint, err)
+	} else if err = res.Body.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close %s response body: %w", endpoint, err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &HTTPError{Endpoint: endpoint, StatusCode: res.StatusCode, Body: string(b)}
+	}
+
+	var apiRes response
+	if err = json.NewDecoder(bytes.NewReader(b)).Decode(&apiRes); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response body: %v", endpoint, err)
+	}
+
+	if len(apiRes.Error) > 0 {
+		return nil, &APIError{Endpoint: endpoint, Errors: apiRes.Error}
+	}
+
+	if v != nil {
+		if err = json.Unmarshal(apiRes.Result, v); err != nil {
+			return nil, fmt.Errorf("failed to decode %s result: %v", endpoint, err)
+		}
+	}
+	return b, nil
+}
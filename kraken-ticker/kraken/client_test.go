@@ -0,0 +1,371 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/kraken/krakentest"
+)
+
+func newTestClient(t *testing.T, opts ...Option) (*Client, *krakentest.Server) {
+	t.Helper()
+	server := krakentest.NewServer()
+	t.Cleanup(server.Close)
+	return NewClient(append([]Option{WithBaseURL(server.URL)}, opts...)...), server
+}
+
+// query returns the query parameters of the last request made to server.
+func query(t *testing.T, server *krakentest.Server) map[string]string {
+	t.Helper()
+	reqs := server.Requests()
+	if len(reqs) == 0 {
+		t.Fatal("no requests made")
+	}
+	params := make(map[string]string)
+	for k, v := range reqs[len(reqs)-1].URL.Query() {
+		params[k] = v[0]
+	}
+	return params
+}
+
+func TestTicker(t *testing.T) {
+	client, server := newTestClient(t)
+	server.SetResult("Ticker", json.RawMessage(`{"XXBTZUSD": {
+		"a": ["30300.10000", "1", "1.000"],
+		"b": ["30300.00000", "2", "2.000"],
+		"c": ["30303.20000", "0.00067643"],
+		"v": ["4083.67001100", "4412.73601799"],
+		"p": ["30706.77771", "30689.13205"],
+		"t": [34619, 38907],
+		"l": ["29868.30000", "29868.10000"],
+		"h": ["31631.00000", "31632.00000"],
+		"o": "30502.80000"
+	}}`))
+
+	tickers, raw, err := client.TickerRaw(context.Background(), "XBTUSD", "ETHUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := query(t, server)["pair"]; got != "XBTUSD,ETHUSD" {
+		t.Errorf("requested pair %q, want XBTUSD,ETHUSD", got)
+	}
+	if len(raw) == 0 {
+		t.Error("TickerRaw returned an empty body")
+	}
+
+	ticker, ok := tickers["XXBTZUSD"]
+	if !ok {
+		t.Fatalf("got tickers %v, want XXBTZUSD", tickers)
+	}
+	for name, tt := range map[string]struct{ got, want string }{
+		"Ask.Price":          {ticker.Ask.Price.String(), "30300.10000"},
+		"Ask.WholeLotVolume": {ticker.Ask.WholeLotVolume.String(), "1"},
+		"Ask.LotVolume":      {ticker.Ask.LotVolume.String(), "1.000"},
+		"Bid.Price":          {ticker.Bid.Price.String(), "30300.00000"},
+		"Close.Price":        {ticker.Close.Price.String(), "30303.20000"},
+		"Close.LotVolume":    {ticker.Close.LotVolume.String(), "0.00067643"},
+		"Volume.Today":       {ticker.Volume.Today.String(), "4083.67001100"},
+		"VWAP.Last24Hours":   {ticker.VWAP.Last24Hours.String(), "30689.13205"},
+		"Low.Last24Hours":    {ticker.Low.Last24Hours.String(), "29868.10000"},
+		"High.Last24Hours":   {ticker.High.Last24Hours.String(), "31632.00000"},
+		"OpeningPrice":       {ticker.OpeningPrice.String(), "30502.80000"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %s, want %s", name, tt.got, tt.want)
+		}
+	}
+	if ticker.Trades.Today != 34619 || ticker.Trades.Last24Hours != 38907 {
+		t.Errorf("got trades %+v, want 34619 today and 38907 in 24h", ticker.Trades)
+	}
+
+	// tickers encode back to Kraken's arrays of strings
+	b, err := json.Marshal(ticker.Ask)
+	if err != nil || string(b) != `["30300.10000","1","1.000"]` {
+		t.Errorf("json.Marshal(Ask) = %s, %v", b, err)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	client, server := newTestClient(t)
+	server.SetResult("Assets", json.RawMessage(`{"XXBT": {"aclass": "currency", "altname": "XBT", "decimals": 10, "display_decimals": 5, "status": "enabled"}}`))
+
+	assets, err := client.Assets(context.Background(), "XBT", "ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := query(t, server)["asset"]; got != "XBT,ETH" {
+		t.Errorf("requested asset %q, want XBT,ETH", got)
+	}
+	want := Asset{AssetClass: "currency", Altname: "XBT", Decimals: 10, DisplayDecimals: 5, Status: "enabled"}
+	if assets["XXBT"] != want {
+		t.Errorf("got %+v, want %+v", assets["XXBT"], want)
+	}
+
+	if _, err = client.Assets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := query(t, server)["asset"]; ok {
+		t.Error("Assets() without assets sent an asset parameter")
+	}
+}
+
+func TestAssetPairs(t *testing.T) {
+	client, server := newTestClient(t)
+	server.SetResult("AssetPairs", json.RawMessage(`{"XXBTZUSD": {
+		"altname": "XBTUSD", "wsname": "XBT/USD", "base": "XXBT", "quote": "ZUSD",
+		"pair_decimals": 1, "lot_decimals": 8, "cost_decimals": 5, "ordermin": "0.0001", "status": "online"
+	}}`))
+
+	pairs, err := client.AssetPairs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pairs["XXBTZUSD"]
+	if p.Altname != "XBTUSD" || p.WSName != "XBT/USD" || p.Base != "XXBT" || p.Quote != "ZUSD" || p.Status != "online" {
+		t.Errorf("got %+v", p)
+	}
+	if p.PairDecimals != 1 || p.LotDecimals != 8 || p.CostDecimals != 5 || p.OrderMin.String() != "0.0001" {
+		t.Errorf("got precision %d/%d/%d and minimum order %s", p.PairDecimals, p.LotDecimals, p.CostDecimals, p.OrderMin)
+	}
+}
+
+func TestOHLC(t *testing.T) {
+	client, server := newTestClient(t)
+	server.SetResult("OHLC", json.RawMessage(`{
+		"XXBTZUSD": [
+			[1688666400, "30260.0", "30300.5", "30250.0", "30280.1", "30275.3", "12.50000000", 120],
+			[1688670000, "30280.1", "30290.0", "30200.0", "30210.0", "30240.0", "8.25000000", 80]
+		],
+		"last": 1688666400
+	}`))
+
+	candles, last, err := client.OHLC(context.Background(), "XBTUSD", 60, 1688662800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := query(t, server)
+	if params["pair"] != "XBTUSD" || params["interval"] != "60" || params["since"] != "1688662800" {
+		t.Errorf("got parameters %v", params)
+	}
+	if last != 1688666400 {
+		t.Errorf("got last %d, want 1688666400", last)
+	}
+	if len(candles) != 2 {
+		t.Fatalf("got %d candles, want 2", len(candles))
+	}
+	c := candles[1]
+	if !c.Time.Equal(time.Unix(1688670000, 0)) || c.Time.Location() != time.UTC {
+		t.Errorf("got time %s, want 2023-07-06T19:00:00Z", c.Time)
+	}
+	if c.Open.String() != "30280.1" || c.High.String() != "30290.0" || c.Low.String() != "30200.0" ||
+		c.Close.String() != "30210.0" || c.VWAP.String() != "30240.0" || c.Volume.String() != "8.25000000" || c.Count != 80 {
+		t.Errorf("got %+v", c)
+	}
+}
+
+func TestDepth(t *testing.T) {
+	client, server := newTestClient(t)
+	// the result is keyed by Kraken's name for the pair rather than the requested name
+	server.SetResult("Depth", json.RawMessage(`{"XXBTZUSD": {
+		"asks": [["30300.1", "1.5", 1688666400], ["30301.0", "0.2", 1688666401]],
+		"bids": [["30300.0", "2.0", 1688666402]]
+	}}`))
+
+	book, err := client.Depth(context.Background(), "XBTUSD", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params := query(t, server); params["pair"] != "XBTUSD" || params["count"] != "10" {
+		t.Errorf("got parameters %v", params)
+	}
+	if len(book.Asks) != 2 || len(book.Bids) != 1 {
+		t.Fatalf("got %d asks and %d bids, want 2 and 1", len(book.Asks), len(book.Bids))
+	}
+	bid := book.Bids[0]
+	if bid.Price.String() != "30300.0" || bid.Volume.String() != "2.0" || !bid.Timestamp.Equal(time.Unix(1688666402, 0)) {
+		t.Errorf("got bid %+v", bid)
+	}
+
+	server.SetResult("Depth", json.RawMessage(`{}`))
+	if _, err = client.Depth(context.Background(), "XBTUSD", 0); err == nil {
+		t.Error("Depth() of an empty result succeeded")
+	}
+	if _, ok := query(t, server)["count"]; ok {
+		t.Error("Depth() with a count of 0 sent a count parameter")
+	}
+}
+
+func TestTrades(t *testing.T) {
+	client, server := newTestClient(t)
+	server.SetResult("Trades", json.RawMessage(`{
+		"XXBTZUSD": [
+			["30300.1", "0.015", 1688666400.1234, "b", "m", "", 61000000],
+			["30299.9", "0.200", 1688666401.5, "s", "l", ""]
+		],
+		"last": "1688666401500000000"
+	}`))
+
+	trades, last, err := client.Trades(context.Background(), "XBTUSD", 1688666400000000000, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := query(t, server)
+	if params["pair"] != "XBTUSD" || params["since"] != "1688666400000000000" || params["count"] != "500" {
+		t.Errorf("got parameters %v", params)
+	}
+	// the cursor is a string of nanoseconds
+	if last != 1688666401500000000 {
+		t.Errorf("got last %d, want 1688666401500000000", last)
+	}
+	if len(trades) != 2 {
+		t.Fatalf("got %d trades, want 2", len(trades))
+	}
+	tr := trades[0]
+	if tr.Price.String() != "30300.1" || tr.Volume.String() != "0.015" || tr.Side != "b" || tr.OrderType != "m" || tr.ID != 61000000 {
+		t.Errorf("got %+v", tr)
+	}
+	if got := tr.Time.Sub(time.Unix(1688666400, 123400000)); got < -time.Microsecond || got > time.Microsecond {
+		t.Errorf("got time %s, want 2023-07-06T18:00:00.1234Z", tr.Time.Format(time.RFC3339Nano))
+	}
+	// older responses have no trade ID
+	if trades[1].ID != 0 || trades[1].Side != "s" {
+		t.Errorf("got %+v", trades[1])
+	}
+}
+
+func TestErrors(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx := context.Background()
+
+	server.SetErrors("Ticker", "EQuery:Unknown asset pair")
+	_, err := client.Ticker(ctx, "NOPE")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Endpoint != "Ticker" || !apiErr.Has("EQuery:Unknown asset pair") {
+		t.Fatalf("Ticker() = %v, want an *APIError", err)
+	}
+	if IsTemporary(err) || IsRateLimited(err) {
+		t.Errorf("%v must not be temporary", err)
+	}
+
+	server.SetErrors("Ticker", ErrRateLimitExceeded)
+	if _, err = client.Ticker(ctx); !IsRateLimited(err) || !IsTemporary(err) {
+		t.Errorf("Ticker() = %v, want a temporary rate limit error", err)
+	}
+
+	for _, tt := range []struct {
+		status    int
+		temporary bool
+		limited   bool
+	}{
+		{http.StatusServiceUnavailable, true, false},
+		{http.StatusTooManyRequests, true, true},
+		{http.StatusNotFound, false, false},
+	} {
+		server.Handle("Depth", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down for maintenance", tt.status)
+		})
+		_, err = client.Depth(ctx, "XBTUSD", 0)
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != tt.status || httpErr.Body != "down for maintenance\n" {
+			t.Errorf("Depth() = %v, want an *HTTPError with status %d", err, tt.status)
+			continue
+		}
+		if errors.As(err, &apiErr) {
+			t.Errorf("Depth() = %v, an HTTP error must not be an *APIError", err)
+		}
+		if IsTemporary(err) != tt.temporary || IsRateLimited(err) != tt.limited {
+			t.Errorf("status %d: got temporary %t rate limited %t", tt.status, IsTemporary(err), IsRateLimited(err))
+		}
+	}
+
+	server.Handle("Assets", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html>")) })
+	if _, err = client.Assets(ctx); err == nil || errors.As(err, &apiErr) {
+		t.Errorf("Assets() = %v, want a decoding error", err)
+	}
+	server.SetResult("AssetPairs", json.RawMessage(`{"XXBTZUSD": {"ordermin": "nope"}}`))
+	if _, err = client.AssetPairs(ctx); err == nil {
+		t.Error("AssetPairs() with an invalid decimal succeeded")
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	client, server := newTestClient(t)
+	started := make(chan struct{})
+	server.Handle("Ticker", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := client.Ticker(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Ticker() = %v, want context.Canceled", err)
+	}
+	if IsTemporary(err) {
+		t.Error("a canceled request must not be temporary")
+	}
+
+	// a deadline is temporary, the request may succeed with more time
+	server.Handle("Assets", func(w http.ResponseWriter, r *http.Request) { <-r.Context().Done() })
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = client.Assets(ctx); !errors.Is(err, context.DeadlineExceeded) || !IsTemporary(err) {
+		t.Errorf("Assets() = %v, want a temporary context.DeadlineExceeded", err)
+	}
+}
+
+// roundTripper counts the requests made through it.
+type roundTripper struct{ requests int }
+
+func (rt *roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.requests++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestOptions(t *testing.T) {
+	server := krakentest.NewServer()
+	defer server.Close()
+	server.SetResult("Ticker", json.RawMessage(`{}`))
+
+	// the default user agent identifies the module
+	if _, err := NewClient(WithBaseURL(server.URL)).Ticker(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.Requests()[0].UserAgent(); got != "github.com/1gm/x/kraken-ticker" {
+		t.Errorf("got default user agent %q", got)
+	}
+
+	rt := &roundTripper{}
+	client := NewClient(
+		// a trailing slash is removed so paths are not doubled
+		WithBaseURL(server.URL+"/"),
+		WithUserAgent("test-agent/1.0"),
+		WithHTTPClient(&http.Client{Transport: rt}),
+	)
+	if _, err := client.Ticker(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	req := server.Requests()[1]
+	if req.URL.Path != "/0/public/Ticker" {
+		t.Errorf("requested %s, want /0/public/Ticker", req.URL.Path)
+	}
+	if got := req.UserAgent(); got != "test-agent/1.0" {
+		t.Errorf("got user agent %q, want test-agent/1.0", got)
+	}
+	if rt.requests != 1 {
+		t.Errorf("custom http.Client made %d requests, want 1", rt.requests)
+	}
+
+	// a nil http.Client keeps the default
+	if c := NewClient(WithHTTPClient(nil)); c.httpClient != http.DefaultClient || c.baseURL != DefaultBaseURL {
+		t.Errorf("got http client %v and base URL %s, want the defaults", c.httpClient, c.baseURL)
+	}
+}
@@ -0,0 +1,93 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Kraken error messages which callers commonly handle.
+const (
+	ErrRateLimitExceeded  = "EAPI:Rate limit exceeded"
+	ErrServiceUnavailable = "EService:Unavailable"
+	ErrServiceBusy        = "EService:Busy"
+	ErrTemporaryLockout   = "EGeneral:Temporary lockout"
+)
+
+// APIError is returned when Kraken responds with one or more errors, e.g.
+// "EQuery:Unknown asset pair".
+type APIError struct {
+	Endpoint string
+	Errors   []string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s api returned errors: %s", e.Endpoint, strings.Join(e.Errors, ", "))
+}
+
+// Has reports whether Kraken returned the error msg, e.g. ErrRateLimitExceeded.
+func (e *APIError) Has(msg string) bool {
+	for _, err := range e.Errors {
+		if strings.HasPrefix(err, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed if retried later.
+func (e *APIError) Temporary() bool {
+	return e.Has(ErrRateLimitExceeded) || e.Has(ErrServiceUnavailable) || e.Has(ErrServiceBusy) || e.Has(ErrTemporaryLockout)
+}
+
+// HTTPError is returned when Kraken responds with a non 200 status code.
+type HTTPError struct {
+	Endpoint   string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s api returned status %d", e.Endpoint, e.StatusCode)
+}
+
+// Temporary reports whether the request may succeed if retried later.
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// IsRateLimited reports whether err is caused by exceeding Kraken's rate limits.
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Has(ErrRateLimitExceeded) || apiErr.Has(ErrTemporaryLockout)
+	}
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests
+}
+
+// IsTemporary reports whether a request which failed with err may succeed if retried,
+// e.g. rate limiting, service outages and network timeouts. Cancellation is never temporary.
+func IsTemporary(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	// any other transport failure, e.g. connection refused or reset, is worth retrying
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,100 @@
+// Package krakentest provides fake Kraken REST and WebSocket APIs for tests.
+package krakentest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Server is a fake Kraken REST API which replies to public endpoints with canned results.
+// Point a kraken.Client at it using kraken.WithBaseURL(server.URL).
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	results  map[string]interface{}
+	errors   map[string][]string
+	handlers map[string]http.HandlerFunc
+	requests []*http.Request
+}
+
+// NewServer starts a Server, callers must Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		results:  make(map[string]interface{}),
+		errors:   make(map[string][]string),
+		handlers: make(map[string]http.HandlerFunc),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// SetResult sets the result returned by the public endpoint, e.g. "Ticker". result is
+// encoded as JSON so it can be a kraken type, a map or a json.RawMessage.
+func (s *Server) SetResult(endpoint string, result interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[endpoint] = result
+	delete(s.errors, endpoint)
+}
+
+// SetErrors makes the public endpoint reply with Kraken API errors, e.g.
+// "EAPI:Rate limit exceeded".
+func (s *Server) SetErrors(endpoint string, errs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[endpoint] = errs
+}
+
+// Handle replaces the handling of the public endpoint with h, e.g. to return different
+// pages depending on the request parameters.
+func (s *Server) Handle(endpoint string, h http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[endpoint] = h
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+// WriteResult writes result in Kraken's response envelope, it can be used by handlers
+// passed to Handle.
+func WriteResult(w http.ResponseWriter, result interface{}, errs ...string) {
+	if errs == nil {
+		errs = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Error  []string    `json:"error"`
+		Result interface{} `json:"result,omitempty"`
+	}{errs, result})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.TrimPrefix(r.URL.Path, "/0/public/")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	h, hasHandler := s.handlers[endpoint]
+	errs, hasErrors := s.errors[endpoint]
+	result, hasResult := s.results[endpoint]
+	s.mu.Unlock()
+
+	switch {
+	case hasHandler:
+		h(w, r)
+	case hasErrors:
+		WriteResult(w, nil, errs...)
+	case hasResult:
+		WriteResult(w, result)
+	default:
+		WriteResult(w, nil, "EGeneral:Unknown method")
+	}
+}
@@ -0,0 +1,225 @@
+package krakentest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// WSSubscription is a subscribe request received by a WSServer.
+type WSSubscription struct {
+	Channel string   `json:"channel"`
+	Symbols []string `json:"symbol"`
+	Depth   int      `json:"depth"`
+}
+
+// WSServer is a fake Kraken WebSocket v2 API. It acknowledges subscriptions, sends
+// heartbeats and lets tests publish channel messages and drop connections. Point a
+// ws.Client at it using ws.WithURL(server.URL).
+type WSServer struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	conns         map[*wsConn]bool
+	connections   int
+	subscriptions []WSSubscription
+	rejected      map[string]string
+	snapshots     map[string]map[string]interface{}
+	heartbeat     time.Duration
+}
+
+type wsConn struct {
+	*websocket.Conn
+	channels map[string]bool
+}
+
+// NewWSServer starts a WSServer sending a heartbeat every second, callers must Close it
+// when done.
+func NewWSServer() *WSServer {
+	s := &WSServer{
+		conns:     make(map[*wsConn]bool),
+		rejected:  make(map[string]string),
+		snapshots: make(map[string]map[string]interface{}),
+		heartbeat: time.Second,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveWS))
+	return s
+}
+
+// SetHeartbeat changes the heartbeat interval for new connections, 0 disables heartbeats
+// to simulate a stalled connection.
+func (s *WSServer) SetHeartbeat(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeat = d
+}
+
+// Reject makes subscriptions to symbol fail with message.
+func (s *WSServer) Reject(symbol, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[symbol] = message
+}
+
+// SetSnapshot sets the data sent for symbol as a snapshot message after each subscription
+// to channel, e.g. a book snapshot or the recent trades.
+func (s *WSServer) SetSnapshot(channel, symbol string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshots[channel] == nil {
+		s.snapshots[channel] = make(map[string]interface{})
+	}
+	s.snapshots[channel][symbol] = data
+}
+
+// Publish sends a channel message of type typ, "snapshot" or "update", to every
+// connection subscribed to channel. data is encoded as JSON so it can be a ws type, a
+// map or a json.RawMessage.
+func (s *WSServer) Publish(channel, typ string, data ...interface{}) {
+	s.mu.Lock()
+	var conns []*wsConn
+	for c := range s.conns {
+		if c.channels[channel] {
+			conns = append(conns, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		writeChannel(c, channel, typ, data...)
+	}
+}
+
+// Subscriptions returns every subscription received so far, including those repeated
+// after reconnecting.
+func (s *WSServer) Subscriptions() []WSSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]WSSubscription(nil), s.subscriptions...)
+}
+
+// Connections returns the number of connections accepted so far.
+func (s *WSServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// Disconnect drops every open connection.
+func (s *WSServer) Disconnect() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = make(map[*wsConn]bool)
+	s.mu.Unlock()
+
+	for c := range conns {
+		c.Close(websocket.StatusGoingAway, "disconnected by test")
+	}
+}
+
+// Close drops every connection and shuts down the server.
+func (s *WSServer) Close() {
+	s.Disconnect()
+	s.Server.Close()
+}
+
+func writeChannel(c *wsConn, channel, typ string, data ...interface{}) {
+	if data == nil {
+		data = []interface{}{}
+	}
+	wsjson.Write(context.Background(), c.Conn, map[string]interface{}{"channel": channel, "type": typ, "data": data})
+}
+
+func (s *WSServer) serveWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &wsConn{Conn: ws, channels: make(map[string]bool)}
+
+	s.mu.Lock()
+	s.conns[c] = true
+	s.connections++
+	heartbeat := s.heartbeat
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		ws.Close(websocket.StatusNormalClosure, "")
+	}()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	writeChannel(c, "status", "update", map[string]interface{}{"api_version": "v2", "system": "online", "version": "2.0.0"})
+	if heartbeat > 0 {
+		go func() {
+			t := time.NewTicker(heartbeat)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					if wsjson.Write(ctx, ws, map[string]string{"channel": "heartbeat"}) != nil {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		var req struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			ReqID  int64           `json:"req_id"`
+		}
+		if err := wsjson.Read(ctx, ws, &req); err != nil {
+			return
+		}
+
+		switch req.Method {
+		case "ping":
+			wsjson.Write(ctx, ws, map[string]interface{}{"method": "pong", "req_id": req.ReqID, "time_in": time.Now().UTC(), "time_out": time.Now().UTC()})
+		case "subscribe":
+			var sub WSSubscription
+			json.Unmarshal(req.Params, &sub)
+			s.subscribe(ctx, c, sub, req.ReqID)
+		}
+	}
+}
+
+func (s *WSServer) subscribe(ctx context.Context, c *wsConn, sub WSSubscription, reqID int64) {
+	s.mu.Lock()
+	s.subscriptions = append(s.subscriptions, sub)
+	c.channels[sub.Channel] = true
+	rejected := make(map[string]string)
+	snapshots := make(map[string]interface{})
+	for _, symbol := range sub.Symbols {
+		if msg, ok := s.rejected[symbol]; ok {
+			rejected[symbol] = msg
+		} else if data, ok := s.snapshots[sub.Channel][symbol]; ok {
+			snapshots[symbol] = data
+		}
+	}
+	s.mu.Unlock()
+
+	for _, symbol := range sub.Symbols {
+		result := map[string]interface{}{"channel": sub.Channel, "symbol": symbol}
+		if msg, ok := rejected[symbol]; ok {
+			wsjson.Write(ctx, c.Conn, map[string]interface{}{"method": "subscribe", "result": result, "success": false, "error": msg, "req_id": reqID})
+			continue
+		}
+		wsjson.Write(ctx, c.Conn, map[string]interface{}{"method": "subscribe", "result": result, "success": true, "req_id": reqID})
+		if data, ok := snapshots[symbol]; ok {
+			writeChannel(c, sub.Channel, "snapshot", data)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+)
+
+// Ticker is the ticker information for an asset pair.
+type Ticker struct {
+	Ask TickerLevel `json:"a"`
+	Bid TickerLevel `json:"b"`
+	// Close is the last trade closed.
+	Close  TickerTrade  `json:"c"`
+	Volume TickerWindow `json:"v"`
+	// VWAP is the volume weighted average price.
+	VWAP   TickerWindow `json:"p"`
+	Trades TickerCounts `json:"t"`
+	Low    TickerWindow `json:"l"`
+	High   TickerWindow `json:"h"`
+	// OpeningPrice is today's opening price.
+	OpeningPrice decimal.Decimal `json:"o"`
+}
+
+// TickerLevel is the best ask or bid, array(<price>, <whole lot volume>, <lot volume>).
+type TickerLevel struct {
+	Price          decimal.Decimal
+	WholeLotVolume decimal.Decimal
+	LotVolume      decimal.Decimal
+}
+
+func (l TickerLevel) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]decimal.Decimal{l.Price, l.WholeLotVolume, l.LotVolume})
+}
+
+func (l *TickerLevel) UnmarshalJSON(b []byte) error {
+	if err := unmarshalArray(b, []interface{}{&l.Price, &l.WholeLotVolume, &l.LotVolume}, 3); err != nil {
+		return fmt.Errorf("invalid ticker level: %v", err)
+	}
+	return nil
+}
+
+// TickerTrade is the last trade, array(<price>, <lot volume>).
+type TickerTrade struct {
+	Price     decimal.Decimal
+	LotVolume decimal.Decimal
+}
+
+func (t TickerTrade) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]decimal.Decimal{t.Price, t.LotVolume})
+}
+
+func (t *TickerTrade) UnmarshalJSON(b []byte) error {
+	if err := unmarshalArray(b, []interface{}{&t.Price, &t.LotVolume}, 2); err != nil {
+		return fmt.Errorf("invalid ticker trade: %v", err)
+	}
+	return nil
+}
+
+// TickerWindow is a value for today and the last 24 hours, array(<today>, <last 24 hours>).
+type TickerWindow struct {
+	Today       decimal.Decimal
+	Last24Hours decimal.Decimal
+}
+
+func (w TickerWindow) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]decimal.Decimal{w.Today, w.Last24Hours})
+}
+
+func (w *TickerWindow) UnmarshalJSON(b []byte) error {
+	if err := unmarshalArray(b, []interface{}{&w.Today, &w.Last24Hours}, 2); err != nil {
+		return fmt.Errorf("invalid ticker window: %v", err)
+	}
+	return nil
+}
+
+// TickerCounts is the number of trades today and in the last 24 hours,
+// array(<today>, <last 24 hours>).
+type TickerCounts struct {
+	Today       int
+	Last24Hours int
+}
+
+func (c TickerCounts) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]int{c.Today, c.Last24Hours})
+}
+
+func (c *TickerCounts) UnmarshalJSON(b []byte) error {
+	if err := unmarshalArray(b, []interface{}{&c.Today, &c.Last24Hours}, 2); err != nil {
+		return fmt.Errorf("invalid ticker counts: %v", err)
+	}
+	return nil
+}
+
+// Ticker returns ticker information keyed by pair name, all pairs are returned if pairs
+// is empty.
+func (c *Client) Ticker(ctx context.Context, pairs ...string) (map[string]Ticker, error) {
+	res, _, err := c.TickerRaw(ctx, pairs...)
+	return res, err
+}
+
+// TickerRaw is Ticker but also returns the raw response body.
+func (c *Client) TickerRaw(ctx context.Context, pairs ...string) (map[string]Ticker, []byte, error) {
+	var res map[string]Ticker
+	raw, err := c.Public(ctx, "Ticker", pairParams(pairs), &res)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, raw, nil
+}
+
+// Asset describes an asset, e.g. XXBT.
+type Asset struct {
+	AssetClass      string `json:"aclass"`
+	Altname         string `json:"altname"`
+	Decimals        int    `json:"decimals"`
+	DisplayDecimals int    `json:"display_decimals"`
+	Status          string `json:"status"`
+}
+
+// Assets returns asset information keyed by asset name, all assets are returned if
+// assets is empty.
+func (c *Client) Assets(ctx context.Context, assets ...string) (map[string]Asset, error) {
+	var params url.Values
+	if len(assets) > 0 {
+		params = url.Values{"asset": {strings.Join(assets, ",")}}
+	}
+	var res map[string]Asset
+	if _, err := c.Public(ctx, "Assets", params, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// AssetPair describes a tradable asset pair, e.g. XXBTZUSD.
+type AssetPair struct {
+	Altname      string          `json:"altname"`
+	WSName       string          `json:"wsname"`
+	Base         string          `json:"base"`
+	Quote        string          `json:"quote"`
+	PairDecimals int             `json:"pair_decimals"`
+	LotDecimals  int             `json:"lot_decimals"`
+	CostDecimals int             `json:"cost_decimals"`
+	OrderMin     decimal.Decimal `json:"ordermin"`
+	Status       string          `json:"status"`
+}
+
+// RoundPrice rounds price to the pair's price precision.
+func (p AssetPair) RoundPrice(price decimal.Decimal) decimal.Decimal {
+	return price.Round(int32(p.PairDecimals))
+}
+
+// RoundVolume rounds volume to the pair's lot precision, use Truncate with LotDecimals to
+// never round a volume up.
+func (p AssetPair) RoundVolume(volume decimal.Decimal) decimal.Decimal {
+	return volume.Round(int32(p.LotDecimals))
+}
+
+// RoundCost rounds cost, price * volume, to the pair's cost precision.
+func (p AssetPair) RoundCost(cost decimal.Decimal) decimal.Decimal {
+	return cost.Round(int32(p.CostDecimals))
+}
+
+// AssetPairs returns asset pair information keyed by pair name, all pairs are returned if
+// pairs is empty.
+func (c *Client) AssetPairs(ctx context.Context, pairs ...string) (map[string]AssetPair, error) {
+	var res map[string]AssetPair
+	if _, err := c.Public(ctx, "AssetPairs", pairParams(pairs), &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Candle is a single OHLC interval.
+type Candle struct {
+	Time   time.Time
+	Open   decimal.Decimal
+	High   decimal.Decimal
+	Low    decimal.Decimal
+	Close  decimal.Decimal
+	VWAP   decimal.Decimal
+	Volume decimal.Decimal
+	Count  int
+}
+
+func (c Candle) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{c.Time.Unix(), c.Open, c.High, c.Low, c.Close, c.VWAP, c.Volume, c.Count})
+}
+
+// UnmarshalJSON decodes array(<time>, <open>, <high>, <low>, <close>, <vwap>, <volume>, <count>).
+func (c *Candle) UnmarshalJSON(b []byte) error {
+	var unixTime int64
+	fields := []interface{}{&unixTime, &c.Open, &c.High, &c.Low, &c.Close, &c.VWAP, &c.Volume, &c.Count}
+	if err := unmarshalArray(b, fields, len(fields)); err != nil {
+		return fmt.Errorf("invalid candle: %v", err)
+	}
+	c.Time = time.Unix(unixTime, 0).UTC()
+	return nil
+}
+
+// OHLC returns candles for pair at the given interval in minutes which started after
+// since, a zero since returns the most recent 720 candles. The returned last is the
+// cursor to pass as since to get the next page.
+func (c *Client) OHLC(ctx context.Context, pair string, interval int, since int64) (candles []Candle, last int64, err error) {
+	params := url.Values{"pair": {pair}}
+	if interval > 0 {
+		params.Set("interval", strconv.Itoa(interval))
+	}
+	if since > 0 {
+		params.Set("since", strconv.FormatInt(since, 10))
+	}
+
+	var res map[string]json.RawMessage
+	if _, err = c.Public(ctx, "OHLC", params, &res); err != nil {
+		return nil, 0, err
+	}
+	if err = decodePaged(res, &candles, &last); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode OHLC result: %v", err)
+	}
+	return candles, last, nil
+}
+
+// BookEntry is a price level in an order book.
+type BookEntry struct {
+	Price     decimal.Decimal
+	Volume    decimal.Decimal
+	Timestamp time.Time
+}
+
+func (e BookEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Price, e.Volume, e.Timestamp.Unix()})
+}
+
+// UnmarshalJSON decodes array(<price>, <volume>, <timestamp>).
+func (e *BookEntry) UnmarshalJSON(b []byte) error {
+	var unixTime int64
+	if err := unmarshalArray(b, []interface{}{&e.Price, &e.Volume, &unixTime}, 3); err != nil {
+		return fmt.Errorf("invalid book entry: %v", err)
+	}
+	e.Timestamp = time.Unix(unixTime, 0).UTC()
+	return nil
+}
+
+// Book is an order book, asks are ordered by ascending price and bids by descending price.
+type Book struct {
+	Asks []BookEntry `json:"asks"`
+	Bids []BookEntry `json:"bids"`
+}
+
+// Depth returns the order book for pair with at most count price levels on each side, a
+// count of 0 uses Kraken's default of 100.
+func (c *Client) Depth(ctx context.Context, pair string, count int) (Book, error) {
+	params := url.Values{"pair": {pair}}
+	if count > 0 {
+		params.Set("count", strconv.Itoa(count))
+	}
+
+	var res map[string]Book
+	if _, err := c.Public(ctx, "Depth", params, &res); err != nil {
+		return Book{}, err
+	}
+	// the result is keyed by Kraken's name for the pair which may differ from pair
+	for _, book := range res {
+		return book, nil
+	}
+	return Book{}, fmt.Errorf("Depth result did not contain %s", pair)
+}
+
+// Trade is a single public trade.
+type Trade struct {
+	Price  decimal.Decimal
+	Volume decimal.Decimal
+	Time   time.Time
+	// Side is "b" for buy or "s" for sell.
+	Side string
+	// OrderType is "m" for market or "l" for limit.
+	OrderType     string
+	Miscellaneous string
+	ID            int64
+}
+
+func (t Trade) MarshalJSON() ([]byte, error) {
+	unixTime := json.Number(strconv.FormatFloat(float64(t.Time.UnixNano())/float64(time.Second), 'f', -1, 64))
+	return json.Marshal([]interface{}{t.Price, t.Volume, unixTime, t.Side, t.OrderType, t.Miscellaneous, t.ID})
+}
+
+// UnmarshalJSON decodes array(<price>, <volume>, <time>, <buy/sell>, <market/limit>, <miscellaneous>, <trade_id>).
+func (t *Trade) UnmarshalJSON(b []byte) error {
+	var unixTime float64
+	fields := []interface{}{&t.Price, &t.Volume, &unixTime, &t.Side, &t.OrderType, &t.Miscellaneous, &t.ID}
+	// older responses do not include the trade ID
+	if err := unmarshalArray(b, fields, 6); err != nil {
+		return fmt.Errorf("invalid trade: %v", err)
+	}
+	t.Time = time.Unix(0, int64(unixTime*float64(time.Second))).UTC()
+	return nil
+}
+
+// Trades returns up to count trades for pair which happened after since, a nanosecond
+// timestamp. A count of 0 uses Kraken's default of 1000. The returned last is the cursor
+// to pass as since to get the next page.
+func (c *Client) Trades(ctx context.Context, pair string, since int64, count int) (trades []Trade, last int64, err error) {
+	params := url.Values{"pair": {pair}}
+	if since > 0 {
+		params.Set("since", strconv.FormatInt(since, 10))
+	}
+	if count > 0 {
+		params.Set("count", strconv.Itoa(count))
+	}
+
+	var res map[string]json.RawMessage
+	if _, err = c.Public(ctx, "Trades", params, &res); err != nil {
+		return nil, 0, err
+	}
+	if err = decodePaged(res, &trades, &last); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode Trades result: %v", err)
+	}
+	return trades, last, nil
+}
+
+func pairParams(pairs []string) url.Values {
+	if len(pairs) == 0 {
+		return nil
+	}
+	return url.Values{"pair": {strings.Join(pairs, ",")}}
+}
+
+// decodePaged decodes results shaped like {"<pair>": [...], "last": <cursor>} where the
+// cursor may be a number or a string.
+func decodePaged(res map[string]json.RawMessage, items interface{}, last *int64) error {
+	for k, v := range res {
+		if k == "last" {
+			var n json.Number
+			if err := json.Unmarshal(bytesTrimQuotes(v), &n); err != nil {
+				return fmt.Errorf("invalid last: %v", err)
+			}
+			var err error
+			if *last, err = n.Int64(); err != nil {
+				return fmt.Errorf("invalid last: %v", err)
+			}
+			continue
+		}
+		if err := json.Unmarshal(v, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bytesTrimQuotes(b []byte) []byte {
+	if len(b) >= 2 && b[0] == '"' && b[len(b)-1] == '"' {
+		return b[1 : len(b)-1]
+	}
+	return b
+}
+
+// unmarshalArray decodes the JSON array b into fields in order. The first required fields
+// must be present, missing optional fields and extra elements are ignored.
+func unmarshalArray(b []byte, fields []interface{}, required int) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) < required {
+		return fmt.Errorf("expected %d elements, got %d", required, len(raw))
+	}
+	for i, f := range fields {
+		if i >= len(raw) {
+			break
+		}
+		if err := json.Unmarshal(raw[i], f); err != nil {
+			return fmt.Errorf("element %d: %v", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+// Package ws is a client for Kraken's public WebSocket v2 API, it streams the ticker,
+// trade and book channels and reconnects when the connection drops.
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// DefaultURL is the address of Kraken's public WebSocket v2 API.
+const DefaultURL = "wss://ws.kraken.com/v2"
+
+// Client streams public market data, it is safe to Run several subscriptions at once.
+type Client struct {
+	url               string
+	heartbeatTimeout  time.Duration
+	maxReconnectDelay time.Duration
+	bookDepth         int
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithURL sets the address connected to, e.g. a krakentest.WSServer URL.
+func WithURL(url string) Option {
+	return func(c *Client) { c.url = url }
+}
+
+// WithHeartbeatTimeout sets how long the connection may be silent before it is assumed
+// dead and reconnected, Kraken sends a heartbeat every second.
+func WithHeartbeatTimeout(d time.Duration) Option {
+	return func(c *Client) { c.heartbeatTimeout = d }
+}
+
+// WithMaxReconnectDelay caps the delay between reconnection attempts.
+func WithMaxReconnectDelay(d time.Duration) Option {
+	return func(c *Client) { c.maxReconnectDelay = d }
+}
+
+// WithBookDepth sets the number of levels subscribed to on each side of the book, one of
+// 10, 25, 100, 500 or 1000.
+func WithBookDepth(depth int) Option {
+	return func(c *Client) { c.bookDepth = depth }
+}
+
+// NewClient creates a Client, by default connecting to DefaultURL.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		url:               DefaultURL,
+		heartbeatTimeout:  10 * time.Second,
+		maxReconnectDelay: 30 * time.Second,
+		bookDepth:         10,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Subscription is a channel and the symbols to receive it for, e.g. "BTC/USD".
+type Subscription struct {
+	Channel string
+	Symbols []string
+	// Precision is the number of decimals of each symbol's prices and quantities, book
+	// checksums are only correct for symbols with a known precision.
+	Precision map[string]Precision
+}
+
+// Handler receives the data streamed by Run, nil functions are skipped. Functions are
+// called from a single goroutine.
+type Handler struct {
+	Ticker func(Ticker)
+	// Trade is called once per trade, trades already seen before a reconnect are dropped.
+	Trade func(Trade)
+	// Book is called with the updated book after every snapshot and update.
+	Book func(*Book)
+	// Gap is called once the stream recovers from a lost connection or skipped trades.
+	Gap func(Gap)
+	// Error is called each time the connection fails, before reconnecting.
+	Error func(error)
+}
+
+// SubscribeError is returned by Run when Kraken rejects a subscription, e.g. for an
+// unknown symbol.
+type SubscribeError struct {
+	Channel string
+	Message string
+}
+
+func (e *SubscribeError) Error() string {
+	return fmt.Sprintf("%s subscription rejected: %s", e.Channel, e.Message)
+}
+
+// state is kept across connections.
+type state struct {
+	subs  []Subscription
+	h     Handler
+	trade map[string]Trade
+	books map[string]*Book
+	depth int
+	// precision of each book symbol and the books which failed their checksum and must be
+	// resubscribed
+	precision map[string]Precision
+	resync    []string
+
+	// lastMessage is when the last message was received, or when Run started before the
+	// first one, it starts a Gap when the connection is lost.
+	lastMessage time.Time
+	lostAt      time.Time
+	lostErr     error
+}
+
+// Run subscribes to subs and streams them to h, reconnecting and resubscribing whenever
+// the connection fails. It returns ctx.Err() once ctx is done or a *SubscribeError.
+func (c *Client) Run(ctx context.Context, subs []Subscription, h Handler) error {
+	st := &state{
+		subs:      subs,
+		h:         h,
+		trade:     make(map[string]Trade),
+		books:     make(map[string]*Book),
+		depth:     c.bookDepth,
+		precision: make(map[string]Precision),
+		// a first connection which fails loses everything since Run started
+		lastMessage: time.Now().UTC(),
+	}
+	for _, sub := range subs {
+		for symbol, p := range sub.Precision {
+			st.precision[symbol] = p
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		subscribed, err := c.connect(ctx, st)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var subErr *SubscribeError
+		if errors.As(err, &subErr) {
+			return err
+		}
+		if subscribed {
+			attempt = 0
+		}
+		if st.lostErr == nil {
+			st.lostAt, st.lostErr = st.lastMessage, err
+		}
+		if h.Error != nil {
+			h.Error(err)
+		}
+
+		select {
+		case <-time.After(c.reconnectDelay(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reconnectDelay doubles from 500ms up to the maximum, with jitter so many clients do
+// not reconnect at once.
+func (c *Client) reconnectDelay(attempt int) time.Duration {
+	d := 500 * time.Millisecond << uint(attempt)
+	if d <= 0 || d > c.maxReconnectDelay {
+		d = c.maxReconnectDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// connect runs a single connection until it fails, subscribed reports whether every
+// subscription was acknowledged.
+func (c *Client) connect(ctx context.Context, st *state) (subscribed bool, err error) {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, _, err := websocket.Dial(dialCtx, c.url, nil)
+	cancel()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	// book snapshots with 1000 levels are larger than the default 32KiB limit
+	conn.SetReadLimit(1 << 22)
+
+	pending := 0
+	for i, sub := range st.subs {
+		params := subscribeParams{Channel: sub.Channel, Symbol: sub.Symbols, Snapshot: true}
+		if sub.Channel == ChannelBook {
+			params.Depth = c.bookDepth
+		}
+		if err = wsjson.Write(ctx, conn, request{Method: "subscribe", Params: params, ReqID: int64(i + 1)}); err != nil {
+			return false, fmt.Errorf("failed to subscribe to %s: %v", sub.Channel, err)
+		}
+		// Kraken acknowledges each symbol separately
+		pending += len(sub.Symbols)
+	}
+
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, c.heartbeatTimeout)
+		var msg message
+		err := wsjson.Read(readCtx, conn, &msg)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return subscribed, ctx.Err()
+			} else if errors.Is(err, context.DeadlineExceeded) {
+				return subscribed, fmt.Errorf("no message received for %s", c.heartbeatTimeout)
+			}
+			return subscribed, fmt.Errorf("failed to read: %v", err)
+		}
+		now := time.Now().UTC()
+
+		if msg.Method == "subscribe" && !subscribed {
+			if msg.Success != nil && !*msg.Success {
+				return false, &SubscribeError{Channel: subscribedChannel(msg.Result), Message: msg.Error}
+			}
+			if pending--; pending == 0 {
+				subscribed = true
+				if st.lostErr != nil {
+					if st.h.Gap != nil {
+						st.h.Gap(Gap{From: st.lostAt, To: now, Reason: st.lostErr.Error()})
+					}
+					st.lostErr = nil
+				}
+			}
+		}
+		st.lastMessage = now
+
+		if err = st.dispatch(msg); err != nil {
+			return subscribed, err
+		}
+		for _, symbol := range st.resync {
+			if err = c.resubscribeBook(ctx, conn, symbol); err != nil {
+				return subscribed, err
+			}
+		}
+		st.resync = st.resync[:0]
+	}
+}
+
+// resubscribeBook requests a new snapshot of symbol's book, updates received before it are
+// dropped.
+func (c *Client) resubscribeBook(ctx context.Context, conn *websocket.Conn, symbol string) error {
+	params := subscribeParams{Channel: ChannelBook, Symbol: []string{symbol}, Depth: c.bookDepth}
+	if err := wsjson.Write(ctx, conn, request{Method: "unsubscribe", Params: params}); err != nil {
+		return fmt.Errorf("failed to unsubscribe from %s book: %v", symbol, err)
+	}
+	params.Snapshot = true
+	if err := wsjson.Write(ctx, conn, request{Method: "subscribe", Params: params}); err != nil {
+		return fmt.Errorf("failed to resubscribe to %s book: %v", symbol, err)
+	}
+	return nil
+}
+
+func subscribedChannel(result json.RawMessage) string {
+	var r struct {
+		Channel string `json:"channel"`
+	}
+	json.Unmarshal(result, &r)
+	return r.Channel
+}
+
+// dispatch passes the data in a channel message to the handler.
+func (st *state) dispatch(msg message) error {
+	switch msg.Channel {
+	case ChannelTicker:
+		var tickers []Ticker
+		if err := json.Unmarshal(msg.Data, &tickers); err != nil {
+			return fmt.Errorf("invalid ticker message: %v", err)
+		}
+		for _, t := range tickers {
+			if st.h.Ticker != nil {
+				st.h.Ticker(t)
+			}
+		}
+	case ChannelTrade:
+		var trades []Trade
+		if err := json.Unmarshal(msg.Data, &trades); err != nil {
+			return fmt.Errorf("invalid trade message: %v", err)
+		}
+		for _, t := range trades {
+			st.onTrade(t)
+		}
+	case ChannelBook:
+		var updates []bookUpdate
+		if err := json.Unmarshal(msg.Data, &updates); err != nil {
+			return fmt.Errorf("invalid book message: %v", err)
+		}
+		for _, u := range updates {
+			book, ok := st.books[u.Symbol]
+			if msg.Type == "snapshot" {
+				book = &Book{Symbol: u.Symbol, Depth: st.depth, Updated: time.Now().UTC()}
+				st.books[u.Symbol] = book
+			} else if !ok {
+				// waiting for the snapshot after a checksum mismatch
+				continue
+			}
+			book.apply(u)
+
+			if sum := Checksum(book, st.precision[u.Symbol]); sum != u.Checksum {
+				delete(st.books, u.Symbol)
+				st.resync = append(st.resync, u.Symbol)
+				if st.h.Gap != nil {
+					st.h.Gap(Gap{
+						Channel: ChannelBook,
+						Symbol:  u.Symbol,
+						From:    book.Updated,
+						To:      time.Now().UTC(),
+						Reason:  fmt.Sprintf("book checksum %d does not match %d, resubscribing", sum, u.Checksum),
+					})
+				}
+				continue
+			}
+			if st.h.Book != nil {
+				st.h.Book(book)
+			}
+		}
+	}
+	// heartbeat, status, pong and acknowledgements carry no data
+	return nil
+}
+
+// onTrade drops trades seen before and reports skipped trade IDs as gaps.
+func (st *state) onTrade(t Trade) {
+	last, ok := st.trade[t.Symbol]
+	if ok && t.TradeID <= last.TradeID {
+		return
+	}
+	if ok && t.TradeID > last.TradeID+1 && st.h.Gap != nil {
+		st.h.Gap(Gap{
+			Channel: ChannelTrade,
+			Symbol:  t.Symbol,
+			From:    last.Timestamp,
+			To:      t.Timestamp,
+			Missed:  t.TradeID - last.TradeID - 1,
+			Reason:  fmt.Sprintf("trade IDs %d to %d skipped", last.TradeID+1, t.TradeID-1),
+		})
+	}
+	st.trade[t.Symbol] = t
+	if st.h.Trade != nil {
+		st.h.Trade(t)
+	}
+}
@@ -0,0 +1,304 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+	"github.com/1gm/x/kraken-ticker/kraken/krakentest"
+)
+
+// events collects everything passed to a Handler so tests can wait for it.
+type events struct {
+	tickers chan Ticker
+	trades  chan Trade
+	books   chan Book
+	gaps    chan Gap
+	errs    chan error
+}
+
+func newEvents() *events {
+	return &events{
+		tickers: make(chan Ticker, 100),
+		trades:  make(chan Trade, 100),
+		books:   make(chan Book, 100),
+		gaps:    make(chan Gap, 100),
+		errs:    make(chan error, 100),
+	}
+}
+
+func (e *events) handler() Handler {
+	return Handler{
+		Ticker: func(t Ticker) { e.tickers <- t },
+		Trade:  func(t Trade) { e.trades <- t },
+		// the book is updated in place, so a copy is kept
+		Book: func(b *Book) {
+			e.books <- Book{Symbol: b.Symbol, Bids: append([]BookLevel(nil), b.Bids...), Asks: append([]BookLevel(nil), b.Asks...)}
+		},
+		Gap:   func(g Gap) { e.gaps <- g },
+		Error: func(err error) { e.errs <- err },
+	}
+}
+
+// receive returns the next value from c, failing the test if none arrives in time.
+func receive[T any](t *testing.T, c <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	panic("unreachable")
+}
+
+// run starts c.Run in the background and returns a function which stops it and returns
+// its error.
+func run(t *testing.T, c *Client, subs []Subscription, h Handler) func() error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx, subs, h) }()
+	var (
+		once sync.Once
+		err  error
+	)
+	stop := func() error {
+		once.Do(func() {
+			cancel()
+			err = receive(t, done, "Run to return")
+		})
+		return err
+	}
+	t.Cleanup(func() { stop() })
+	return stop
+}
+
+func trade(id int64, at time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"symbol": "BTC/USD", "side": "buy", "price": "30000.1", "qty": "0.5", "ord_type": "market",
+		"trade_id": id, "timestamp": at.Format(time.RFC3339Nano),
+	}
+}
+
+func TestRunSubscribe(t *testing.T) {
+	server := krakentest.NewWSServer()
+	defer server.Close()
+	server.SetSnapshot(ChannelTicker, "BTC/USD", json.RawMessage(`{"symbol": "BTC/USD", "bid": "30000.0", "ask": "30000.1", "last": "30000.05", "volume": "1234.5"}`))
+
+	ev := newEvents()
+	stop := run(t, NewClient(WithURL(server.URL)), []Subscription{{Channel: ChannelTicker, Symbols: []string{"BTC/USD", "ETH/USD"}}}, ev.handler())
+
+	ticker := receive(t, ev.tickers, "the ticker snapshot")
+	if ticker.Symbol != "BTC/USD" || ticker.Bid.String() != "30000.0" || ticker.Ask.String() != "30000.1" || ticker.Last.String() != "30000.05" {
+		t.Errorf("got ticker %+v", ticker)
+	}
+	subs := server.Subscriptions()
+	if len(subs) != 1 || subs[0].Channel != ChannelTicker || strings.Join(subs[0].Symbols, ",") != "BTC/USD,ETH/USD" {
+		t.Errorf("got subscriptions %+v", subs)
+	}
+
+	server.Publish(ChannelTicker, "update", json.RawMessage(`{"symbol": "ETH/USD", "last": "1900.12"}`))
+	if ticker = receive(t, ev.tickers, "a ticker update"); ticker.Symbol != "ETH/USD" || ticker.Last.String() != "1900.12" {
+		t.Errorf("got ticker %+v", ticker)
+	}
+
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v, want context.Canceled", err)
+	}
+}
+
+func TestRunSubscribeRejected(t *testing.T) {
+	server := krakentest.NewWSServer()
+	defer server.Close()
+	server.Reject("NOPE/USD", "Currency pair not supported NOPE/USD")
+
+	ev := newEvents()
+	c := NewClient(WithURL(server.URL), WithMaxReconnectDelay(10*time.Millisecond))
+	err := c.Run(context.Background(), []Subscription{{Channel: ChannelTrade, Symbols: []string{"BTC/USD", "NOPE/USD"}}}, ev.handler())
+
+	var subErr *SubscribeError
+	if !errors.As(err, &subErr) || subErr.Channel != ChannelTrade || subErr.Message != "Currency pair not supported NOPE/USD" {
+		t.Fatalf("Run() = %v, want a trade *SubscribeError", err)
+	}
+	// a rejected subscription fails the same way every time, so it is not retried
+	if n := server.Connections(); n != 1 {
+		t.Errorf("got %d connections, want 1", n)
+	}
+}
+
+func TestRunHeartbeatTimeout(t *testing.T) {
+	server := krakentest.NewWSServer()
+	defer server.Close()
+	// without heartbeats the connection goes silent after the subscription is acknowledged
+	server.SetHeartbeat(0)
+
+	ev := newEvents()
+	c := NewClient(WithURL(server.URL), WithHeartbeatTimeout(200*time.Millisecond), WithMaxReconnectDelay(10*time.Millisecond))
+	subs := []Subscription{
+		{Channel: ChannelTicker, Symbols: []string{"BTC/USD"}},
+		{Channel: ChannelTrade, Symbols: []string{"BTC/USD"}},
+	}
+	start := time.Now()
+	run(t, c, subs, ev.handler())
+
+	err := receive(t, ev.errs, "the heartbeat timeout")
+	if !strings.Contains(err.Error(), "no message received for 200ms") {
+		t.Errorf("got error %v, want a heartbeat timeout", err)
+	}
+	gap := receive(t, ev.gaps, "the gap of the lost connection")
+	if gap.Channel != "" || gap.Reason != err.Error() || gap.From.Before(start) || !gap.To.After(gap.From) {
+		t.Errorf("got gap %+v, want the whole connection from after %s", gap, start)
+	}
+
+	if n := server.Connections(); n < 2 {
+		t.Errorf("got %d connections, want a reconnect", n)
+	}
+	// every subscription is repeated on the new connection
+	got := server.Subscriptions()
+	if len(got) < 4 || got[2].Channel != ChannelTicker || got[3].Channel != ChannelTrade {
+		t.Errorf("got subscriptions %+v, want ticker and trade twice", got)
+	}
+}
+
+func TestRunResubscribe(t *testing.T) {
+	server := krakentest.NewWSServer()
+	defer server.Close()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	server.SetSnapshot(ChannelTrade, "BTC/USD", trade(1, start))
+
+	ev := newEvents()
+	run(t, NewClient(WithURL(server.URL), WithMaxReconnectDelay(10*time.Millisecond)), []Subscription{{Channel: ChannelTrade, Symbols: []string{"BTC/USD"}}}, ev.handler())
+	receive(t, ev.trades, "the trade snapshot")
+	server.Publish(ChannelTrade, "update", trade(2, start.Add(time.Second)))
+	if tr := receive(t, ev.trades, "a trade update"); tr.TradeID != 2 {
+		t.Errorf("got trade %d, want 2", tr.TradeID)
+	}
+
+	server.Disconnect()
+	receive(t, ev.errs, "the dropped connection")
+	gap := receive(t, ev.gaps, "the gap of the lost connection")
+	if gap.Channel != "" || gap.To.Before(gap.From) {
+		t.Errorf("got gap %+v", gap)
+	}
+	if subs := server.Subscriptions(); len(subs) != 2 || subs[1].Channel != ChannelTrade {
+		t.Errorf("got subscriptions %+v, want the trade channel twice", subs)
+	}
+
+	// the snapshot sent after resubscribing repeats trade 1, which is dropped
+	server.Publish(ChannelTrade, "update", trade(3, start.Add(2*time.Second)))
+	if tr := receive(t, ev.trades, "the trade after reconnecting"); tr.TradeID != 3 {
+		t.Errorf("got trade %d after reconnecting, want 3", tr.TradeID)
+	}
+}
+
+func TestRunTradeGap(t *testing.T) {
+	server := krakentest.NewWSServer()
+	defer server.Close()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	server.SetSnapshot(ChannelTrade, "BTC/USD", trade(10, start))
+
+	ev := newEvents()
+	run(t, NewClient(WithURL(server.URL)), []Subscription{{Channel: ChannelTrade, Symbols: []string{"BTC/USD"}}}, ev.handler())
+	receive(t, ev.trades, "the trade snapshot")
+
+	server.Publish(ChannelTrade, "update", trade(11, start.Add(time.Second)), trade(11, start.Add(time.Second)), trade(15, start.Add(5*time.Second)))
+	var ids []int64
+	for i := 0; i < 2; i++ {
+		ids = append(ids, receive(t, ev.trades, "trade updates").TradeID)
+	}
+	if ids[0] != 11 || ids[1] != 15 {
+		t.Errorf("got trades %v, want 11 and 15 with the repeated 11 dropped", ids)
+	}
+
+	gap := receive(t, ev.gaps, "the trade gap")
+	want := Gap{Channel: ChannelTrade, Symbol: "BTC/USD", From: start.Add(time.Second), To: start.Add(5 * time.Second), Missed: 3, Reason: "trade IDs 12 to 14 skipped"}
+	if gap != want {
+		t.Errorf("got gap %+v, want %+v", gap, want)
+	}
+	select {
+	case g := <-ev.gaps:
+		t.Errorf("got unexpected gap %+v", g)
+	default:
+	}
+}
+
+func TestRunBookChecksum(t *testing.T) {
+	server := krakentest.NewWSServer()
+	defer server.Close()
+
+	level := func(price, qty string) BookLevel {
+		return BookLevel{Price: decimal.Must(price), Qty: decimal.Must(qty)}
+	}
+	bids := []BookLevel{level("30000.0", "1.50000000"), level("29999.5", "2.00000000")}
+	asks := []BookLevel{level("30000.1", "0.25000000"), level("30001.0", "3.00000000")}
+	checksum := Checksum(&Book{Bids: bids, Asks: asks}, Precision{})
+	snapshot := map[string]interface{}{"symbol": "BTC/USD", "bids": bids, "asks": asks, "checksum": checksum}
+	server.SetSnapshot(ChannelBook, "BTC/USD", snapshot)
+
+	ev := newEvents()
+	run(t, NewClient(WithURL(server.URL), WithBookDepth(10)), []Subscription{{Channel: ChannelBook, Symbols: []string{"BTC/USD"}}}, ev.handler())
+	book := receive(t, ev.books, "the book snapshot")
+	if len(book.Bids) != 2 || len(book.Asks) != 2 || book.Bids[0].Price.String() != "30000.0" || book.Asks[0].Price.String() != "30000.1" {
+		t.Errorf("got book %+v", book)
+	}
+	if subs := server.Subscriptions(); len(subs) != 1 || subs[0].Depth != 10 {
+		t.Errorf("got subscriptions %+v, want a book of depth 10", subs)
+	}
+
+	// an update whose checksum does not match the local book triggers a resync
+	server.Publish(ChannelBook, "update", map[string]interface{}{
+		"symbol": "BTC/USD", "bids": []BookLevel{level("30000.0", "1.00000000")}, "checksum": checksum + 1,
+	})
+	gap := receive(t, ev.gaps, "the checksum mismatch")
+	if gap.Channel != ChannelBook || gap.Symbol != "BTC/USD" || !strings.Contains(gap.Reason, "does not match") {
+		t.Errorf("got gap %+v, want a BTC/USD book checksum mismatch", gap)
+	}
+
+	// the book is resubscribed and rebuilt from the new snapshot
+	book = receive(t, ev.books, "the book after resubscribing")
+	if book.Bids[0].Qty.String() != "1.50000000" {
+		t.Errorf("got best bid %+v, want the snapshot's", book.Bids[0])
+	}
+	subs := server.Subscriptions()
+	if len(subs) != 2 || subs[1].Channel != ChannelBook || strings.Join(subs[1].Symbols, ",") != "BTC/USD" {
+		t.Errorf("got subscriptions %+v, want the book resubscribed", subs)
+	}
+	if n := server.Connections(); n != 1 {
+		t.Errorf("got %d connections, a resync must not reconnect", n)
+	}
+}
+
+func TestRunFirstConnectFails(t *testing.T) {
+	ws := krakentest.NewWSServer()
+	defer ws.Close()
+	// the first connection attempt is refused
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		ws.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ev := newEvents()
+	start := time.Now()
+	run(t, NewClient(WithURL(server.URL), WithMaxReconnectDelay(10*time.Millisecond)), []Subscription{{Channel: ChannelTicker, Symbols: []string{"BTC/USD"}}}, ev.handler())
+
+	receive(t, ev.errs, "the failed connection")
+	gap := receive(t, ev.gaps, "the gap of the failed connection")
+	// the gap starts when Run started rather than at the zero time
+	if gap.From.Before(start.Add(-time.Second)) || gap.From.After(gap.To) {
+		t.Errorf("got gap from %s to %s, want it to start at %s", gap.From, gap.To, start)
+	}
+}
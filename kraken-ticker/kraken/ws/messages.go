@@ -0,0 +1,177 @@
+package ws
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+)
+
+// Channels which can be subscribed to.
+const (
+	ChannelTicker = "ticker"
+	ChannelTrade  = "trade"
+	ChannelBook   = "book"
+)
+
+// Ticker is a level 1 update for a symbol, volume and prices cover the last 24 hours.
+type Ticker struct {
+	Symbol    string          `json:"symbol"`
+	Bid       decimal.Decimal `json:"bid"`
+	BidQty    decimal.Decimal `json:"bid_qty"`
+	Ask       decimal.Decimal `json:"ask"`
+	AskQty    decimal.Decimal `json:"ask_qty"`
+	Last      decimal.Decimal `json:"last"`
+	Volume    decimal.Decimal `json:"volume"`
+	VWAP      decimal.Decimal `json:"vwap"`
+	Low       decimal.Decimal `json:"low"`
+	High      decimal.Decimal `json:"high"`
+	Change    decimal.Decimal `json:"change"`
+	ChangePct decimal.Decimal `json:"change_pct"`
+}
+
+// Trade is a single trade, trade IDs increase by one per symbol so a jump means trades
+// were missed.
+type Trade struct {
+	Symbol    string          `json:"symbol"`
+	Side      string          `json:"side"`
+	Price     decimal.Decimal `json:"price"`
+	Qty       decimal.Decimal `json:"qty"`
+	OrderType string          `json:"ord_type"`
+	TradeID   int64           `json:"trade_id"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// BookLevel is a price level in an order book.
+type BookLevel struct {
+	Price decimal.Decimal `json:"price"`
+	Qty   decimal.Decimal `json:"qty"`
+}
+
+// bookUpdate is a book snapshot or the levels which changed since the last update, a
+// level with a zero quantity is removed.
+type bookUpdate struct {
+	Symbol    string      `json:"symbol"`
+	Bids      []BookLevel `json:"bids"`
+	Asks      []BookLevel `json:"asks"`
+	Checksum  uint32      `json:"checksum"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// Book is a local copy of an order book kept up to date from the book channel. Asks are
+// ordered by ascending price and bids by descending price.
+type Book struct {
+	Symbol string
+	// Depth is the number of levels kept on each side.
+	Depth int
+	Bids  []BookLevel
+	Asks  []BookLevel
+	// Updated is the time of the last update, or when the snapshot was received.
+	Updated time.Time
+}
+
+func (b *Book) apply(u bookUpdate) {
+	b.Bids = applyLevels(b.Bids, u.Bids, b.Depth, func(x, y decimal.Decimal) bool { return x.Cmp(y) > 0 })
+	b.Asks = applyLevels(b.Asks, u.Asks, b.Depth, func(x, y decimal.Decimal) bool { return x.Cmp(y) < 0 })
+	if !u.Timestamp.IsZero() {
+		b.Updated = u.Timestamp
+	}
+}
+
+// applyLevels merges updates into levels, which are sorted by before, and truncates the
+// result to depth levels.
+func applyLevels(levels, updates []BookLevel, depth int, before func(x, y decimal.Decimal) bool) []BookLevel {
+	for _, u := range updates {
+		i := sort.Search(len(levels), func(i int) bool { return !before(levels[i].Price, u.Price) })
+		exists := i < len(levels) && levels[i].Price.Cmp(u.Price) == 0
+		switch {
+		case u.Qty.IsZero() && exists:
+			levels = append(levels[:i], levels[i+1:]...)
+		case u.Qty.IsZero():
+		case exists:
+			levels[i] = u
+		default:
+			levels = append(levels, BookLevel{})
+			copy(levels[i+1:], levels[i:])
+			levels[i] = u
+		}
+	}
+	if depth > 0 && len(levels) > depth {
+		levels = levels[:depth]
+	}
+	return levels
+}
+
+// Precision is the number of decimals in a symbol's prices and quantities, e.g. the
+// pair_decimals and lot_decimals of an asset pair.
+type Precision struct {
+	Price int32
+	Qty   int32
+}
+
+// checksumLevels is the number of levels on each side included in a book checksum.
+const checksumLevels = 10
+
+// Checksum returns the CRC32 checksum Kraken sends with book messages, computed from the
+// top 10 asks then the top 10 bids. Each level contributes its price and quantity written
+// with p's decimals, without the decimal point and leading zeros. A zero Precision uses
+// the levels as they were received.
+func Checksum(b *Book, p Precision) uint32 {
+	var sb strings.Builder
+	format := func(d decimal.Decimal, decimals int32) {
+		if p != (Precision{}) {
+			d = d.Round(decimals)
+		}
+		sb.WriteString(strings.TrimLeft(strings.Replace(d.String(), ".", "", 1), "0"))
+	}
+	for _, levels := range [][]BookLevel{b.Asks, b.Bids} {
+		for i := 0; i < len(levels) && i < checksumLevels; i++ {
+			format(levels[i].Price, p.Price)
+			format(levels[i].Qty, p.Qty)
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(sb.String()))
+}
+
+// Gap is a period data may have been missed, either because the connection dropped, trade
+// IDs were skipped or a book failed its checksum.
+type Gap struct {
+	// Channel and Symbol are empty when the whole connection was lost.
+	Channel string
+	Symbol  string
+	From    time.Time
+	To      time.Time
+	// Missed is the number of missed trades, 0 for other gaps.
+	Missed int64
+	Reason string
+}
+
+// message is the envelope of every message sent by Kraken.
+type message struct {
+	Channel string          `json:"channel"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+
+	// set on responses to requests
+	Method  string          `json:"method"`
+	Success *bool           `json:"success"`
+	Error   string          `json:"error"`
+	Result  json.RawMessage `json:"result"`
+	ReqID   int64           `json:"req_id"`
+}
+
+type request struct {
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+	ReqID  int64       `json:"req_id"`
+}
+
+type subscribeParams struct {
+	Channel  string   `json:"channel"`
+	Symbol   []string `json:"symbol"`
+	Depth    int      `json:"depth,omitempty"`
+	Snapshot bool     `json:"snapshot"`
+}
@@ -1,38 +1,119 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/1gm/x/internal/log"
+	"github.com/1gm/x/kraken-ticker/alert"
+	"github.com/1gm/x/kraken-ticker/exchange"
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/kraken/ws"
+	"github.com/1gm/x/kraken-ticker/orderbook"
+	"github.com/1gm/x/kraken-ticker/snapshot"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
 )
 
+type options struct {
+	directory        string
+	createDirectory  bool
+	compress         bool
+	compression      string
+	delta            bool
+	keyframe         int
+	format           string
+	raw              bool
+	pairs            string
+	pairsFile        string
+	summary          string
+	exchange         string
+	apiURL           string
+	interval         time.Duration
+	retries          int
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	stream           bool
+	wsURL            string
+	channels         string
+	alerts           string
+	book             bool
+	bookDepth        int
+	metricsAddr      string
+	rollup           bool
+	retainRaw        int
+	retain           int
+	candleInterval   time.Duration
+	minFreeMB        int
+	holdings         string
+	currency         string
+}
+
 func main() {
-	out := flag.String("o", "data", "directory to save results")
-	compress := flag.Bool("c", false, "gzip data before saving")
-	mkdir := flag.Bool("mkdir", false, "make directory for '-o' if it does not exist (will be equivalent to 'mkdir -p')")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "query":
+			os.Exit(queryMain(os.Args[2:], os.Stdout))
+		case "replay":
+			os.Exit(replayMain(os.Args[2:], os.Stdout))
+		case "backfill":
+			os.Exit(backfillMain(os.Args[2:]))
+		}
+	}
+
+	var opts options
+	flag.StringVar(&opts.directory, "o", "data", "directory to save results")
+	flag.BoolVar(&opts.compress, "c", false, "gzip raw responses before saving, same as -compression gzip (requires -raw)")
+	flag.StringVar(&opts.compression, "compression", "", "compression of raw responses, none, gzip or zstd (requires -raw)")
+	flag.BoolVar(&opts.delta, "delta", false, "only save the pairs which changed since the previous raw response (requires -raw)")
+	flag.IntVar(&opts.keyframe, "keyframe", 60, "with -delta, save the full response every this many polls")
+	flag.StringVar(&opts.format, "format", "csv", "format of the per-pair daily files, csv or binary")
+	flag.BoolVar(&opts.raw, "raw", false, "also save every raw JSON response to the output directory")
+	flag.BoolVar(&opts.createDirectory, "mkdir", false, "make directory for '-o' if it does not exist (will be equivalent to 'mkdir -p')")
+	flag.StringVar(&opts.pairs, "pairs", "", "comma separated list of pairs to track, e.g. XBTUSD,ETH/USD (defaults to all pairs)")
+	flag.StringVar(&opts.pairsFile, "pairs-file", "", "file listing pairs to track, one per line, e.g. pairs.txt")
+	flag.StringVar(&opts.summary, "summary", defaultSummary, "text/template for the line logged for each tracked pair, executed with .Pair, .Symbol, .Quote and .Ticker")
+	flag.StringVar(&opts.exchange, "exchange", "kraken", "exchange to collect from, -stream and -book are only supported for kraken")
+	flag.StringVar(&opts.apiURL, "api", kraken.DefaultBaseURL, "Kraken REST API base URL")
+	flag.DurationVar(&opts.interval, "interval", time.Minute, "how often to poll the ticker")
+	flag.IntVar(&opts.retries, "retries", 5, "number of times a failed fetch is retried within a poll interval")
+	flag.IntVar(&opts.breakerThreshold, "breaker-threshold", 5, "consecutive failed polls before polling is paused")
+	flag.DurationVar(&opts.breakerCooldown, "breaker-cooldown", 5*time.Minute, "how long polling is paused once the breaker trips")
+	flag.BoolVar(&opts.stream, "stream", false, "stream the WebSocket API instead of polling, records are saved for every ticker update")
+	flag.StringVar(&opts.wsURL, "ws", ws.DefaultURL, "Kraken WebSocket v2 API URL used by -stream")
+	flag.StringVar(&opts.channels, "channels", "ticker,trade", "comma separated WebSocket channels used by -stream, ticker, trade and book")
+	flag.StringVar(&opts.alerts, "alerts", "", "JSON file of alert rules and notifiers evaluated against every snapshot")
+	flag.BoolVar(&opts.book, "book", false, "also save order book snapshots and spread/liquidity metrics for the tracked pairs")
+	flag.IntVar(&opts.bookDepth, "book-depth", 100, "order book levels saved on each side, one of 10, 25, 100, 500 or 1000 with -stream")
+	flag.StringVar(&opts.metricsAddr, "metrics", "", "address to serve Prometheus metrics on at /metrics, e.g. :9090 (disabled by default)")
+	flag.BoolVar(&opts.rollup, "rollup", false, "bundle each finished UTC day of raw responses into <-o>/archive/<day>.tar.gz with a manifest and checksums")
+	flag.IntVar(&opts.retainRaw, "retain-raw", 0, "days raw responses and their archives are kept, 0 keeps them forever")
+	flag.IntVar(&opts.retain, "retain", 0, "days ticker and order book snapshots are kept, older ticker snapshots are downsampled to candles (0 keeps them forever)")
+	flag.DurationVar(&opts.candleInterval, "candle-interval", time.Hour, "interval of the candles kept for snapshots removed by -retain")
+	flag.IntVar(&opts.minFreeMB, "min-free-mb", 1024, "pause saving raw responses while the output directory has less free space, 0 disables the check")
+	flag.StringVar(&opts.holdings, "holdings", "", "CSV file of asset, quantity and cost basis to value after every poll")
+	flag.StringVar(&opts.currency, "currency", "USD", "currency -holdings are valued in, their cost basis must be in this currency")
 	flag.Parse()
 
-	exitCode := realMain(*out, *mkdir, *compress)
+	exitCode := realMain(opts)
 	os.Exit(exitCode)
 }
-func realMain(directory string, createDirectory bool, compress bool) int {
+func realMain(opts options) int {
 	log := log.New()
 	defer log.Sync()
 
+	directory := opts.directory
 	if fi, err := os.Stat(directory); err != nil {
-		if os.IsNotExist(err) && createDirectory {
+		if os.IsNotExist(err) && opts.createDirectory {
 			if err = os.MkdirAll(directory, 0666); err != nil {
 				log.Errorf("failed to create directory: %v", err)
 				return 1
@@ -46,108 +127,368 @@ func realMain(directory string, createDirectory bool, compress bool) int {
 	}
 	log.Infof("results will be written into %q", directory)
 
+	if opts.interval <= 0 {
+		log.Error("-interval must be positive")
+		return 1
+	}
+
+	format, err := store.ParseFormat(opts.format)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	st, err := store.Open(filepath.Join(directory, "ticker"), format, store.WithLogger(log))
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	var (
+		snapshots *snapshot.Writer
+		guard     *diskGuard
+	)
+	if opts.raw {
+		if snapshots, err = newSnapshotWriter(directory, opts); err != nil {
+			log.Error(err)
+			return 1
+		}
+		if opts.minFreeMB > 0 {
+			if _, err := freeSpace(directory); errors.Is(err, errFreeSpaceUnsupported) {
+				log.Warnf("ignoring -min-free-mb, %v", err)
+			} else {
+				guard = &diskGuard{directory: directory, minFree: uint64(opts.minFreeMB) << 20}
+			}
+		}
+	}
+
+	summary, err := parseSummary(opts.summary)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	names, err := parsePairs(opts.pairs, opts.pairsFile)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	client := kraken.NewClient(kraken.WithBaseURL(opts.apiURL))
+
 	ctx, cancel := context.WithCancel(context.Background())
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() { <-c; cancel() }()
 
-	for {
-		now := time.Now().UTC().Format(time.RFC3339)
-		log.Info("fetching rates at ", now)
-		pairs, raw, err := fetchTickerPairs(ctx)
-		if err != nil {
+	ex, err := newExchange(opts, client)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	// without any configured pairs every pair is downloaded and only BTC/USD is summarized
+	lookup := names
+	if len(lookup) == 0 {
+		lookup = []string{"BTC/USD"}
+	}
+	var resolved map[string]string
+	err = retry(ctx, opts.retries, startupBackoff, func(ctx context.Context) (err error) {
+		resolved, err = resolvePairs(ctx, ex, lookup)
+		return err
+	}, func(attempt int, delay time.Duration, err error) {
+		log.Warnf("failed to resolve pairs, retry %d/%d in %s: %v", attempt, opts.retries, delay.Round(time.Millisecond), err)
+	})
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	tracked := sortedKeys(resolved)
+
+	var portfolio *valuer
+	if opts.holdings != "" {
+		if portfolio, err = loadValuer(ctx, log, opts, ex); err != nil {
 			log.Error(err)
 			return 1
 		}
-
-		var buf *bytes.Buffer
-		filename := filepath.Join(directory, now+".json")
-		if compress {
-			filename += ".gz"
-			if err = gzipCompress(buf, raw); err != nil {
-				log.Error("failed to compress raw response: ", err)
-				return 1
+		// every pair is fetched when polling without -pairs, otherwise the pairs needed to
+		// value the holdings are tracked as well
+		if len(names) > 0 || opts.stream {
+			for _, pair := range portfolio.pairs() {
+				resolved[pair] = pair
 			}
-		} else {
-			buf = bytes.NewBuffer(raw)
+			tracked = sortedKeys(resolved)
 		}
+	}
+
+	var requested []string
+	if len(names) > 0 {
+		requested = tracked
+		log.Infof("tracking %d pairs on %s", len(tracked), ex.Name())
+	}
+
+	var alerts *alert.Engine
+	if opts.alerts != "" {
+		if alerts, err = loadAlerts(ctx, log, opts, ex, tracked, requested); err != nil {
+			log.Error(err)
+			return 1
+		}
+		defer alerts.Wait()
+	}
+
+	gaps := &gapTracker{filename: filepath.Join(directory, "gaps.jsonl")}
+	defer func() {
+		if err := gaps.Close(); err != nil {
+			log.Error("failed to record gap: ", err)
+		}
+	}()
+
+	var books *orderbook.Store
+	if opts.book {
+		if books, err = orderbook.OpenStore(filepath.Join(directory, "book")); err != nil {
+			log.Error(err)
+			return 1
+		}
+	}
 
-		log.Info("saving rates to ", filename)
-		if err = os.WriteFile(filename, buf.Bytes(), os.ModePerm); err != nil {
-			log.Error("failed to save response: ", err)
+	if opts.retainRaw < 0 || opts.retain < 0 {
+		log.Error("-retain and -retain-raw must not be negative")
+		return 1
+	}
+	if opts.candleInterval < time.Second {
+		log.Error("-candle-interval must be at least 1s")
+		return 1
+	}
+	house := &housekeeper{
+		log:            log,
+		directory:      directory,
+		store:          st,
+		books:          books,
+		rollup:         opts.rollup,
+		retainRaw:      opts.retainRaw,
+		retain:         opts.retain,
+		candleInterval: opts.candleInterval,
+	}
+
+	var metrics *exporter
+	if opts.metricsAddr != "" {
+		ln, err := net.Listen("tcp", opts.metricsAddr)
+		if err != nil {
+			log.Errorf("failed to serve metrics: %v", err)
 			return 1
 		}
+		log.Infof("serving metrics on http://%s/metrics", ln.Addr())
+		metrics = newExporter(tracked)
+		errc := make(chan error, 1)
+		go func() { errc <- metrics.serve(ctx, ln) }()
+		defer func() {
+			cancel()
+			if err := <-errc; err != nil {
+				log.Error("failed to serve metrics: ", err)
+			}
+		}()
+	}
+
+	if opts.stream {
+		return stream(ctx, log, opts, client, st, gaps, alerts, books, metrics, house, portfolio, tracked)
+	}
 
-		log.Info("BTC/USD rate (today): ", pairs["XXBTZUSD"].VolumeWeightedAveragePrice[0])
-		log.Info("BTC/USD rate (24 hours): ", pairs["XXBTZUSD"].VolumeWeightedAveragePrice[1])
+	col := &collector{
+		log:       log,
+		exchange:  ex,
+		client:    client,
+		store:     st,
+		snapshots: snapshots,
+		guard:     guard,
+		requested: requested,
+		tracked:   tracked,
+		summary:   summary,
+		retries:   opts.retries,
+		backoff:   backoff{base: time.Second, max: opts.interval / 2, rateLimited: 10 * time.Second},
+		breaker:   &circuitBreaker{threshold: opts.breakerThreshold, cooldown: opts.breakerCooldown},
+		gaps:      gaps,
+		alerts:    alerts,
+		books:     books,
+		bookDepth: opts.bookDepth,
+		metrics:   metrics,
+		portfolio: portfolio,
+	}
+
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	for scheduled := time.Now(); ; {
+		if err := col.poll(ctx, scheduled); err != nil {
+			log.Error(err)
+			return 1
+		}
+		house.run(time.Now())
 
 		select {
-		case <-time.After(time.Minute):
+		case scheduled = <-ticker.C:
 
 		case <-ctx.Done():
 			log.Info("shutting down")
 			return 0
 		}
 	}
-
-	return 0
 }
 
-func fetchTickerPairs(ctx context.Context) (pairs map[string]tickerPair, raw []byte, err error) {
-	apiRes, err := http.DefaultClient.Get("https://api.kraken.com/0/public/Ticker")
+// newSnapshotWriter creates the writer for raw responses configured by -c, -compression,
+// -delta and -keyframe.
+func newSnapshotWriter(directory string, opts options) (*snapshot.Writer, error) {
+	compression, err := snapshot.ParseCompression(opts.compression)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get ticker: %v", err)
+		return nil, err
+	}
+	if opts.compress {
+		if opts.compression != "" && compression != snapshot.Gzip {
+			return nil, fmt.Errorf("-c conflicts with -compression %s", compression)
+		}
+		compression = snapshot.Gzip
+	}
+	snapshotOpts := []snapshot.Option{snapshot.WithCompression(compression)}
+	if opts.delta {
+		if opts.keyframe < 1 {
+			return nil, fmt.Errorf("-keyframe must be at least 1")
+		}
+		snapshotOpts = append(snapshotOpts, snapshot.WithDelta(opts.keyframe))
 	}
+	return snapshot.NewWriter(directory, snapshotOpts...), nil
+}
 
-	b, err := io.ReadAll(apiRes.Body)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read response body: %v", err)
-	} else if err = apiRes.Body.Close(); err != nil {
-		return nil, nil, fmt.Errorf("failed to close response body: %v", err)
+// newExchange creates the provider selected by -exchange. Streaming and order books use
+// Kraken's APIs directly.
+func newExchange(opts options, client *kraken.Client) (exchange.Exchange, error) {
+	switch opts.exchange {
+	case "kraken":
+		return exchange.NewKraken(client), nil
 	}
+	return nil, fmt.Errorf("unknown exchange %q, expected kraken", opts.exchange)
+}
 
-	var res tickerResponse
-	if err = json.NewDecoder(bytes.NewReader(b)).Decode(&res); err != nil {
-		return nil, nil, fmt.Errorf("failed to decode ticker response body: %v", err)
+// loadAlerts reads the alerts file and resolves the pairs its rules refer to.
+func loadAlerts(ctx context.Context, log *zap.SugaredLogger, opts options, ex exchange.Exchange, tracked, requested []string) (*alert.Engine, error) {
+	config, err := alert.LoadConfig(opts.alerts)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(res.Error) > 0 {
-		return nil, nil, fmt.Errorf("ticker api returned errors: %s", strings.Join(res.Error, "\n"))
+	var names []string
+	for _, r := range config.Rules {
+		names = append(names, strings.ToUpper(r.Pair))
+	}
+	var resolved map[string]string
+	err = retry(ctx, opts.retries, startupBackoff, func(ctx context.Context) (err error) {
+		resolved, err = resolvePairs(ctx, ex, names)
+		return err
+	}, func(attempt int, delay time.Duration, err error) {
+		log.Warnf("failed to resolve alert pairs, retry %d/%d in %s: %v", attempt, opts.retries, delay.Round(time.Millisecond), err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert rule: %w", err)
 	}
 
-	return res.Result, b, nil
-}
+	isTracked := make(map[string]bool)
+	for _, key := range tracked {
+		isTracked[key] = true
+	}
+	for i := range config.Rules {
+		r := &config.Rules[i]
+		r.Pair = resolved[strings.ToUpper(r.Pair)]
+		// every pair is saved when polling without -pairs but only tracked pairs are streamed
+		if (len(requested) > 0 || opts.stream) && !isTracked[r.Pair] {
+			log.Warnf("alert rule %q is for %s which is not tracked", r.Name, r.Pair)
+		}
+	}
 
-type tickerResponse struct {
-	Error  []string              `json:"error"`
-	Result map[string]tickerPair `json:"result"`
+	notifiers := make([]alert.Notifier, 0, len(config.Notifiers))
+	for _, n := range config.Notifiers {
+		notifiers = append(notifiers, n.New(log))
+	}
+	log.Infof("loaded %d alert rules", len(config.Rules))
+	return alert.NewEngine(log, config.Rules, notifiers), nil
 }
 
-type tickerPair struct {
-	// Ask array(<price>, <whole lot volume>, <lot volume>)
-	Ask []string `json:"a"`
-	// Bid array(<price>, <whole lot volume>, <lot volume>)
-	Bid []string `json:"b"`
-	// Last trade closed array(<price>, <lot volume>)
-	Close []string `json:"c"`
-	// Volume array(<today>, <last 24 hours>)
-	Volume []string `json:"v"`
-	// Volume weighted average price array(<today>, <last 24 hours>)
-	VolumeWeightedAveragePrice []string `json:"p"`
-	// Number of trades array(<today>, <last 24 hours>)
-	Trades []int `json:"t"`
-	// Low array(<today>, <last 24 hours>)
-	Low []string `json:"l"`
-	// High array(<today>, <last 24 hours>)
-	High []string `json:"h"`
-	// Today's opening price
-	OpeningPrice float64 `json:"o,string"`
-}
+// stream runs the WebSocket streamer for the tracked pairs until ctx is done.
+func stream(ctx context.Context, log *zap.SugaredLogger, opts options, client *kraken.Client, st *store.Store, gaps *gapTracker, alerts *alert.Engine, books *orderbook.Store, metrics *exporter, house *housekeeper, portfolio *valuer, tracked []string) int {
+	var channels []string
+	hasBook, hasTrade := false, false
+	for _, ch := range strings.Split(opts.channels, ",") {
+		switch ch = strings.TrimSpace(ch); ch {
+		case ws.ChannelTicker, ws.ChannelTrade, ws.ChannelBook:
+			channels = append(channels, ch)
+			hasBook = hasBook || ch == ws.ChannelBook
+			hasTrade = hasTrade || ch == ws.ChannelTrade
+		case "":
+		default:
+			log.Errorf("unknown channel %q, expected ticker, trade or book", ch)
+			return 1
+		}
+	}
+	if books != nil && !hasBook {
+		channels = append(channels, ws.ChannelBook)
+		hasBook = true
+	}
+	if len(channels) == 0 {
+		log.Error("-channels must list at least one channel")
+		return 1
+	}
+	if hasBook {
+		switch opts.bookDepth {
+		case 10, 25, 100, 500, 1000:
+		default:
+			log.Error("-book-depth must be 10, 25, 100, 500 or 1000 when streaming")
+			return 1
+		}
+	}
 
-func gzipCompress(w io.Writer, b []byte) error {
-	gz := gzip.NewWriter(w)
-	if _, err := gz.Write(b); err != nil {
+	var assetPairs map[string]kraken.AssetPair
+	err := retry(ctx, opts.retries, startupBackoff, func(ctx context.Context) (err error) {
+		assetPairs, err = client.AssetPairs(ctx, tracked...)
 		return err
+	}, func(attempt int, delay time.Duration, err error) {
+		log.Warnf("failed to get asset pairs, retry %d/%d in %s: %v", attempt, opts.retries, delay.Round(time.Millisecond), err)
+	})
+	if err != nil {
+		log.Error("failed to get asset pairs: ", err)
+		return 1
+	}
+	pairs := make(map[string]string, len(tracked))
+	precision := make(map[string]ws.Precision, len(tracked))
+	for _, key := range tracked {
+		p, ok := assetPairs[key]
+		if !ok || p.WSName == "" {
+			log.Errorf("%s cannot be streamed", key)
+			return 1
+		}
+		symbol := exchange.KrakenSymbol(p.WSName)
+		pairs[symbol] = key
+		precision[symbol] = ws.Precision{Price: int32(p.PairDecimals), Qty: int32(p.LotDecimals)}
+	}
+
+	log.Infof("streaming %s for %d pairs", strings.Join(channels, ", "), len(pairs))
+	s := newStreamer(log, st, gaps, alerts, books, metrics, house, portfolio, pairs)
+	wsClient := ws.NewClient(ws.WithURL(opts.wsURL), ws.WithBookDepth(opts.bookDepth))
+	ex := exchange.NewKraken(client, exchange.WithWebSocket(ws.NewClient(ws.WithURL(opts.wsURL)),
+		ws.Handler{Gap: s.onGap, Error: s.onDisconnect}))
+	if hasTrade {
+		// trades are streamed by symbol, fetch the pairs before streaming so a temporary
+		// failure is retried
+		err = retry(ctx, opts.retries, startupBackoff, func(ctx context.Context) error {
+			_, err := ex.Pairs(ctx)
+			return err
+		}, func(attempt int, delay time.Duration, err error) {
+			log.Warnf("failed to get pairs, retry %d/%d in %s: %v", attempt, opts.retries, delay.Round(time.Millisecond), err)
+		})
+		if err != nil {
+			log.Error(err)
+			return 1
+		}
 	}
-	return gz.Close()
+	if err := s.run(ctx, wsClient, ex, channels, precision, opts.interval); err != nil {
+		log.Error(err)
+		return 1
+	}
+	log.Info("shutting down")
+	return 0
 }
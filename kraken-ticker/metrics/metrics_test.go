@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, rewriting the file with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	filename := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(filename, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output does not match %s, run go test -update to accept it\ngot:\n%s\nwant:\n%s", filename, got, want)
+	}
+}
+
+func testRegistry() *Registry {
+	r := NewRegistry()
+
+	up := r.Gauge("ticker_up", "Whether the last poll succeeded.")
+	up.Set(1)
+
+	price := r.Gauge("ticker_last_price", "Last trade price of each pair.", "pair")
+	price.Set(30000.1, "XXBTZUSD")
+	price.Set(1900.5, "XETHZUSD")
+	price.Set(math.Inf(1), "INF")
+	price.Set(math.NaN(), "NAN")
+
+	// label values and help text are escaped, help text keeps its quotes
+	escaped := r.Counter("ticker_errors_total", "Errors by \"kind\", a \\ or a\nnewline.", "kind", "detail")
+	escaped.Inc("quote\"d", `back\slash`)
+	escaped.Add(2.5, "new\nline", "plain")
+
+	latency := r.Histogram("ticker_poll_seconds", "Duration of each poll.", []float64{1, 0.1, 0.5}, "endpoint")
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		latency.Observe(v, "Ticker")
+	}
+	latency.Observe(0.7, "Depth")
+
+	r.Histogram("ticker_empty_seconds", "A histogram without labels or observations.", []float64{1})
+	r.Counter("ticker_unused_total", "A counter whose labelled series were never set.", "pair")
+	return r
+}
+
+func TestWriteTo(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := testRegistry().WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+	golden(t, "metrics.golden", buf.Bytes())
+}
+
+func TestServeHTTP(t *testing.T) {
+	w := httptest.NewRecorder()
+	testRegistry().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if got := w.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got content type %q", got)
+	}
+	golden(t, "metrics.golden", w.Body.Bytes())
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	r := NewRegistry()
+	r.Gauge("ticker_up", "")
+	r.Counter("ticker_up", "")
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("setting a series with the wrong number of label values did not panic")
+		}
+	}()
+	NewRegistry().Gauge("ticker_last_price", "", "pair").Set(1, "XXBTZUSD", "extra")
+}
@@ -0,0 +1,108 @@
+// Package orderbook stores order book snapshots and derives spread and liquidity metrics
+// from them.
+package orderbook
+
+import (
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/kraken/ws"
+)
+
+// Level is a price level in a book.
+type Level struct {
+	Price  decimal.Decimal `json:"price"`
+	Volume decimal.Decimal `json:"volume"`
+}
+
+// Snapshot is an order book at a point in time, asks are ordered by ascending price and
+// bids by descending price.
+type Snapshot struct {
+	Time time.Time `json:"time"`
+	Pair string    `json:"pair"`
+	Bids []Level   `json:"bids"`
+	Asks []Level   `json:"asks"`
+}
+
+// FromDepth converts a book returned by the REST Depth endpoint.
+func FromDepth(t time.Time, pair string, b kraken.Book) Snapshot {
+	s := Snapshot{Time: t.UTC(), Pair: pair}
+	for _, e := range b.Bids {
+		s.Bids = append(s.Bids, Level{Price: e.Price, Volume: e.Volume})
+	}
+	for _, e := range b.Asks {
+		s.Asks = append(s.Asks, Level{Price: e.Price, Volume: e.Volume})
+	}
+	return s
+}
+
+// FromStream converts a book kept up to date from the WebSocket book channel.
+func FromStream(t time.Time, pair string, b *ws.Book) Snapshot {
+	s := Snapshot{Time: t.UTC(), Pair: pair}
+	for _, l := range b.Bids {
+		s.Bids = append(s.Bids, Level{Price: l.Price, Volume: l.Qty})
+	}
+	for _, l := range b.Asks {
+		s.Asks = append(s.Asks, Level{Price: l.Price, Volume: l.Qty})
+	}
+	return s
+}
+
+// Metrics summarizes the liquidity of a Snapshot. Depths are base asset volumes within a
+// percentage of the mid price, so they only cover as much of the book as the snapshot
+// holds.
+type Metrics struct {
+	Time    time.Time `json:"time"`
+	Pair    string    `json:"pair"`
+	BestBid float64   `json:"best_bid"`
+	BestAsk float64   `json:"best_ask"`
+	Spread  float64   `json:"spread"`
+	Mid     float64   `json:"mid"`
+	// SpreadBps is the spread in basis points of the mid price.
+	SpreadBps float64 `json:"spread_bps"`
+	BidDepth1 float64 `json:"bid_depth_1pct"`
+	AskDepth1 float64 `json:"ask_depth_1pct"`
+	BidDepth2 float64 `json:"bid_depth_2pct"`
+	AskDepth2 float64 `json:"ask_depth_2pct"`
+	// Imbalance is (bid depth - ask depth) / (bid depth + ask depth) within 1% of the mid
+	// price, from -1 when there are only asks to 1 when there are only bids.
+	Imbalance float64 `json:"imbalance"`
+}
+
+// Metrics derives the spread, depth and imbalance of s, a side without levels leaves the
+// metrics which need it at 0.
+func (s Snapshot) Metrics() Metrics {
+	m := Metrics{Time: s.Time, Pair: s.Pair}
+	if len(s.Bids) == 0 || len(s.Asks) == 0 {
+		return m
+	}
+	bid, ask := s.Bids[0].Price, s.Asks[0].Price
+	m.BestBid, m.BestAsk = bid.Float64(), ask.Float64()
+	// the spread and mid are computed exactly so a one tick spread is not 0.0999999
+	m.Spread = ask.Sub(bid).Float64()
+	m.Mid = ask.Add(bid).Quo(decimal.New(2, 0), ask.Scale()+bid.Scale()+1).Float64()
+	m.SpreadBps = m.Spread / m.Mid * 10000
+
+	m.BidDepth1 = depth(s.Bids, func(p float64) bool { return p >= m.Mid*0.99 })
+	m.BidDepth2 = depth(s.Bids, func(p float64) bool { return p >= m.Mid*0.98 })
+	m.AskDepth1 = depth(s.Asks, func(p float64) bool { return p <= m.Mid*1.01 })
+	m.AskDepth2 = depth(s.Asks, func(p float64) bool { return p <= m.Mid*1.02 })
+	if total := m.BidDepth1 + m.AskDepth1; total > 0 {
+		m.Imbalance = (m.BidDepth1 - m.AskDepth1) / total
+	}
+	return m
+}
+
+// depth sums the volume of levels, which are ordered from the best price, while within
+// returns true for their price.
+func depth(levels []Level, within func(price float64) bool) float64 {
+	var v float64
+	for _, l := range levels {
+		if !within(l.Price.Float64()) {
+			break
+		}
+		v += l.Volume.Float64()
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+package orderbook
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsColumns is the header of the metrics files.
+var metricsColumns = []string{
+	"time", "best_bid", "best_ask", "spread", "mid", "spread_bps",
+	"bid_depth_1pct", "ask_depth_1pct", "bid_depth_2pct", "ask_depth_2pct", "imbalance",
+}
+
+// Store appends each snapshot to <dir>/<pair>/<day>.jsonl and its metrics to
+// <dir>/<pair>/<day>.metrics.csv.
+type Store struct {
+	dir string
+}
+
+// OpenStore opens the store in dir, creating dir if needed.
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create book directory: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Append saves snapshots and their metrics, returning the metrics.
+func (s *Store) Append(snapshots ...Snapshot) ([]Metrics, error) {
+	metrics := make([]Metrics, 0, len(snapshots))
+	for _, snap := range snapshots {
+		dir := filepath.Join(s.dir, snap.Pair)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create pair directory: %v", err)
+		}
+		day := snap.Time.UTC().Format("2006-01-02")
+
+		b, err := json.Marshal(snap)
+		if err != nil {
+			return nil, err
+		}
+		if err = appendFile(filepath.Join(dir, day+".jsonl"), func(f *os.File, _ bool) error {
+			_, err := f.Write(append(b, '\n'))
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("failed to save %s book: %v", snap.Pair, err)
+		}
+
+		m := snap.Metrics()
+		if err = appendFile(filepath.Join(dir, day+".metrics.csv"), func(f *os.File, created bool) error {
+			return writeMetrics(f, m, created)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to save %s book metrics: %v", snap.Pair, err)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// Prune removes the snapshots of days before the day before, given as yyyy-mm-dd, and
+// returns the names of the files removed. Metrics files are kept.
+func (s *Store) Prune(before string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*", "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, f := range files {
+		if day := strings.TrimSuffix(filepath.Base(f), ".jsonl"); day >= before {
+			continue
+		}
+		if err = os.Remove(f); err != nil {
+			return removed, err
+		}
+		removed = append(removed, f)
+	}
+	return removed, nil
+}
+
+func appendFile(filename string, write func(f *os.File, created bool) error) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err == nil {
+		err = write(f, fi.Size() == 0)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeMetrics(f *os.File, m Metrics, header bool) error {
+	w := csv.NewWriter(f)
+	if header {
+		w.Write(metricsColumns)
+	}
+	row := []string{m.Time.UTC().Format(time.RFC3339Nano)}
+	for _, v := range []float64{m.BestBid, m.BestAsk, m.Spread, m.Mid, m.SpreadBps, m.BidDepth1, m.AskDepth1, m.BidDepth2, m.AskDepth2, m.Imbalance} {
+		row = append(row, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	w.Write(row)
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/1gm/x/kraken-ticker/exchange"
+)
+
+// parsePairs combines the comma separated pairs in list with the pairs in filename, one
+// per line. Blank lines and lines starting with '#' are ignored, duplicates are removed.
+func parsePairs(list string, filename string) ([]string, error) {
+	pairs := strings.Split(list, ",")
+
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pairs file: %v", err)
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			pairs = append(pairs, scanner.Text())
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read pairs file: %v", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, p := range pairs {
+		p = strings.ToUpper(strings.TrimSpace(p))
+		if p == "" || strings.HasPrefix(p, "#") || seen[p] {
+			continue
+		}
+		seen[p] = true
+		unique = append(unique, p)
+	}
+	return unique, nil
+}
+
+// resolvePairs maps each of names to the key the exchange uses for the pair, e.g. XBTUSD,
+// XBT/USD and BTC/USD all resolve to Kraken's XXBTZUSD, see exchange.Resolve.
+func resolvePairs(ctx context.Context, ex exchange.Exchange, names []string) (map[string]string, error) {
+	pairs, err := ex.Pairs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return exchange.Resolve(pairs, names)
+}
+
+// sortedKeys returns the unique values of resolved in order.
+func sortedKeys(resolved map[string]string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, k := range resolved {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// defaultSummary is the template for the line logged for each tracked pair.
+const defaultSummary = `{{.Pair}} last={{.Quote.Last}} ask={{.Quote.Ask}} bid={{.Quote.Bid}} vwap(today)={{.Quote.VWAPToday}} vwap(24h)={{.Quote.VWAP24h}}`
+
+// summaryData is executed by the summary template. Ticker is the exchange's own ticker,
+// e.g. a kraken.Ticker, so templates written for Kraken's fields keep working.
+type summaryData struct {
+	Pair   string
+	Symbol string
+	Quote  exchange.Quote
+	Ticker interface{}
+}
+
+func parseSummary(text string) (*template.Template, error) {
+	t, err := template.New("summary").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid summary template: %v", err)
+	}
+	return t, nil
+}
+
+func summarize(t *template.Template, q exchange.Quote) (string, error) {
+	var sb strings.Builder
+	if err := t.Execute(&sb, summaryData{Pair: q.Pair, Symbol: q.Symbol, Quote: q, Ticker: q.Native}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
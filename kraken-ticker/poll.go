@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/kraken"
+)
+
+// backoff computes exponential retry delays with full jitter.
+type backoff struct {
+	base time.Duration
+	max  time.Duration
+	// rateLimited is the minimum delay after Kraken reports the rate limit was exceeded,
+	// it is still capped by max.
+	rateLimited time.Duration
+}
+
+// delay returns how long to wait before retry attempt (starting at 0) after err.
+func (b backoff) delay(attempt int, err error) time.Duration {
+	// doubling stops before it can pass max, shifting by attempt overflows for large
+	// attempt counts and can wrap to any delay
+	d := b.base
+	for i := 0; i < attempt && d > 0; i++ {
+		if d >= b.max/2 {
+			d = b.max
+			break
+		}
+		d *= 2
+	}
+	if d <= 0 || d > b.max {
+		d = b.max
+	}
+	d = time.Duration(rand.Int63n(int64(d) + 1))
+	if kraken.IsRateLimited(err) && d < b.rateLimited {
+		d = b.rateLimited
+	}
+	if d > b.max {
+		d = b.max
+	}
+	return d
+}
+
+// startupBackoff is used for requests made before polling starts.
+var startupBackoff = backoff{base: time.Second, max: 30 * time.Second, rateLimited: 10 * time.Second}
+
+// retry calls fn until it succeeds, fails with an error which is not temporary or has been
+// retried retries times. onRetry is called before waiting for each retry.
+func retry(ctx context.Context, retries int, b backoff, fn func(context.Context) error, onRetry func(attempt int, delay time.Duration, err error)) error {
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= retries || !kraken.IsTemporary(err) {
+			return err
+		}
+
+		d := b.delay(attempt, err)
+		onRetry(attempt+1, d, err)
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// circuitBreaker stops polling after too many consecutive failures, allowing a single
+// trial poll once cooldown has passed.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether a poll should be attempted at now.
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	return cb.failures < cb.threshold || !now.Before(cb.openUntil)
+}
+
+// success closes the circuit.
+func (cb *circuitBreaker) success() {
+	cb.failures = 0
+	cb.openUntil = time.Time{}
+}
+
+// failure records a failed poll at now and reports whether the circuit opened.
+func (cb *circuitBreaker) failure(now time.Time) bool {
+	cb.failures++
+	if cb.failures >= cb.threshold {
+		cb.openUntil = now.Add(cb.cooldown)
+		return true
+	}
+	return false
+}
+
+// gap is a run of consecutive poll intervals for which no data was saved, Reason is the
+// error which caused the first missed poll. In stream mode it is a dropped connection or,
+// with Pair set, a run of Missed trades.
+type gap struct {
+	// Pair is set for gaps affecting a single pair, e.g. skipped streamed trades.
+	Pair   string    `json:"pair,omitempty"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Missed int       `json:"missed"`
+	Reason string    `json:"reason"`
+}
+
+// gapTracker records missed poll intervals, appending each gap to a JSON lines file once
+// polling recovers or the tracker is closed.
+type gapTracker struct {
+	filename string
+
+	mu      sync.Mutex
+	current *gap
+}
+
+// miss records that the interval scheduled at t was missed because of reason.
+func (g *gapTracker) miss(t time.Time, reason string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	t = t.UTC().Truncate(time.Second)
+	if g.current == nil {
+		g.current = &gap{From: t, Reason: reason}
+	}
+	g.current.To = t
+	g.current.Missed++
+}
+
+// ok records that data was saved, writing out the gap which preceded it if any.
+func (g *gapTracker) ok() (*gap, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.current == nil {
+		return nil, nil
+	}
+	closed := g.current
+	g.current = nil
+	return closed, g.write(closed)
+}
+
+// record writes out a gap which is already over, e.g. a dropped stream connection.
+func (g *gapTracker) record(gp gap) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gp.From, gp.To = gp.From.UTC().Truncate(time.Second), gp.To.UTC().Truncate(time.Second)
+	return g.write(&gp)
+}
+
+func (g *gapTracker) write(gp *gap) error {
+	b, err := json.Marshal(gp)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(g.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open gaps file: %v", err)
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write gap: %v", err)
+	}
+	return f.Close()
+}
+
+// Close writes out the current gap if there is one.
+func (g *gapTracker) Close() error {
+	_, err := g.ok()
+	return err
+}
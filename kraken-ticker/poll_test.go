@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := backoff{base: time.Second, max: 30 * time.Second}
+	for _, attempt := range []int{0, 1, 4, 5, 33, 34, 62, 63, 64, 1000} {
+		// full jitter picks a delay up to the cap, the cap must be base doubled attempt
+		// times or max
+		want := b.max
+		if attempt < 5 {
+			want = b.base << uint(attempt)
+		}
+		var longest time.Duration
+		for i := 0; i < 1000; i++ {
+			d := b.delay(attempt, errors.New("failed"))
+			if d < 0 || d > want {
+				t.Fatalf("attempt %d: got delay %s, want at most %s", attempt, d, want)
+			}
+			if d > longest {
+				longest = d
+			}
+		}
+		if longest < want*3/4 {
+			t.Errorf("attempt %d: longest of 1000 delays is %s, want close to %s", attempt, longest, want)
+		}
+	}
+}
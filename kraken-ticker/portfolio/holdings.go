@@ -0,0 +1,85 @@
+// Package portfolio values holdings of several assets in a single currency from ticker
+// snapshots and tracks their unrealized profit and loss.
+package portfolio
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Holding is a position in an asset.
+type Holding struct {
+	// Asset is the common asset code, e.g. BTC rather than Kraken's XBT.
+	Asset    string
+	Quantity float64
+	// CostBasis is the total amount paid for the position, in the valuation currency.
+	CostBasis float64
+}
+
+// LoadHoldings reads a CSV file of asset, quantity and cost basis, e.g. BTC,0.5,15000. A
+// header row, blank lines and lines starting with '#' are ignored and holdings of the same
+// asset are added together.
+func LoadHoldings(filename string) ([]Holding, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open holdings file: %v", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var holdings []Holding
+	index := make(map[string]int)
+	for first := true; ; first = false {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read holdings file: %v", err)
+		}
+		if first && strings.EqualFold(strings.TrimSpace(row[0]), "asset") {
+			continue
+		}
+		h, err := parseHolding(row)
+		if err != nil {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("invalid holding on line %d: %v", line, err)
+		}
+		if i, ok := index[h.Asset]; ok {
+			holdings[i].Quantity += h.Quantity
+			holdings[i].CostBasis += h.CostBasis
+			continue
+		}
+		index[h.Asset] = len(holdings)
+		holdings = append(holdings, h)
+	}
+	if len(holdings) == 0 {
+		return nil, fmt.Errorf("holdings file %s is empty", filename)
+	}
+	return holdings, nil
+}
+
+func parseHolding(row []string) (Holding, error) {
+	if len(row) != 3 {
+		return Holding{}, fmt.Errorf("expected asset, quantity and cost basis, got %d fields", len(row))
+	}
+	h := Holding{Asset: strings.ToUpper(strings.TrimSpace(row[0]))}
+	if h.Asset == "" {
+		return Holding{}, fmt.Errorf("missing asset")
+	}
+	var err error
+	if h.Quantity, err = strconv.ParseFloat(strings.TrimSpace(row[1]), 64); err != nil || h.Quantity < 0 {
+		return Holding{}, fmt.Errorf("invalid quantity %q", row[1])
+	}
+	if h.CostBasis, err = strconv.ParseFloat(strings.TrimSpace(row[2]), 64); err != nil || h.CostBasis < 0 {
+		return Holding{}, fmt.Errorf("invalid cost basis %q", row[2])
+	}
+	return h, nil
+}
@@ -0,0 +1,72 @@
+package portfolio
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// columns is the header of the valuation files.
+var columns = []string{"time", "asset", "quantity", "price", "value", "cost_basis", "pnl", "pnl_pct", "path", "currency"}
+
+// Store appends each valuation to <dir>/<day>.csv, a row per asset followed by a row for
+// the total whose asset is "total".
+type Store struct {
+	dir string
+}
+
+// OpenStore opens the store in dir, creating dir if needed.
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create portfolio directory: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string { return s.dir }
+
+// Append saves val.
+func (s *Store) Append(val Valuation) error {
+	filename := filepath.Join(s.dir, val.Time.UTC().Format("2006-01-02")+".csv")
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save valuation: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save valuation: %v", err)
+	}
+
+	w := csv.NewWriter(f)
+	if fi.Size() == 0 {
+		w.Write(columns)
+	}
+	t := val.Time.UTC().Format(time.RFC3339)
+	for _, a := range val.Assets {
+		w.Write([]string{
+			t, a.Asset, formatFloat(a.Quantity), formatFloat(a.Price), formatFloat(a.Value), formatFloat(a.CostBasis),
+			formatFloat(a.PnL), strconv.FormatFloat(a.PnLPercent, 'f', 4, 64), a.Path, val.Currency,
+		})
+	}
+	// the total has no quantity or price
+	total := val.Total
+	w.Write([]string{
+		t, "total", "", "", formatFloat(total.Value), formatFloat(total.CostBasis),
+		formatFloat(total.PnL), strconv.FormatFloat(total.PnLPercent, 'f', 4, 64), "", val.Currency,
+	})
+	w.Flush()
+	if err = w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save valuation: %v", err)
+	}
+	return f.Close()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,216 @@
+package portfolio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+	"github.com/1gm/x/kraken-ticker/exchange"
+	"github.com/1gm/x/kraken-ticker/store"
+)
+
+// leg converts an amount of one asset to the next asset of a route using the price of
+// pair, which is inverted when the route sells the pair's quote asset for its base asset.
+type leg struct {
+	pair   string
+	invert bool
+}
+
+// route converts an asset to the valuation currency, path lists every asset along the way
+// starting with the asset itself.
+type route struct {
+	legs []leg
+	path []string
+}
+
+// Valuer values holdings in a currency from the latest price of each pair, see Update.
+// Assets without a pair to the currency are triangulated through intermediate assets,
+// e.g. DOT through DOT/EUR and EUR/USD for USD.
+type Valuer struct {
+	currency string
+	holdings []Holding
+	routes   map[string]route
+	// prices is the latest price of each pair in a route.
+	prices map[string]float64
+}
+
+// NewValuer finds the shortest route from every held asset to currency through pairs, it
+// fails when an asset cannot be converted to currency.
+func NewValuer(pairs []exchange.Pair, holdings []Holding, currency string) (*Valuer, error) {
+	currency = strings.ToUpper(currency)
+
+	// edges[asset] are the pairs which convert asset to another asset, in key order so
+	// routes do not change between runs
+	sorted := append([]exchange.Pair(nil), pairs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	type edge struct {
+		to string
+		leg
+	}
+	edges := make(map[string][]edge)
+	for _, p := range sorted {
+		if p.Base == "" || p.Quote == "" {
+			continue
+		}
+		edges[p.Base] = append(edges[p.Base], edge{to: p.Quote, leg: leg{pair: p.Key}})
+		edges[p.Quote] = append(edges[p.Quote], edge{to: p.Base, leg: leg{pair: p.Key, invert: true}})
+	}
+
+	// a breadth first search from currency finds the route with the fewest legs from
+	// every asset, walking each edge backwards
+	type step struct {
+		next string
+		leg  leg
+	}
+	prev := map[string]step{currency: {}}
+	queue := []string{currency}
+	for len(queue) > 0 {
+		asset := queue[0]
+		queue = queue[1:]
+		for _, e := range edges[asset] {
+			if _, ok := prev[e.to]; ok {
+				continue
+			}
+			// e converts asset to e.to, the route from e.to uses the same pair the other way
+			prev[e.to] = step{next: asset, leg: leg{pair: e.pair, invert: !e.invert}}
+			queue = append(queue, e.to)
+		}
+	}
+
+	v := &Valuer{currency: currency, holdings: holdings, routes: make(map[string]route), prices: make(map[string]float64)}
+	var unknown []string
+	for _, h := range holdings {
+		if _, ok := prev[h.Asset]; !ok {
+			unknown = append(unknown, h.Asset)
+			continue
+		}
+		r := route{path: []string{h.Asset}}
+		for asset := h.Asset; asset != currency; {
+			s := prev[asset]
+			r.legs = append(r.legs, s.leg)
+			r.path = append(r.path, s.next)
+			asset = s.next
+		}
+		v.routes[h.Asset] = r
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("no pairs convert %s to %s", strings.Join(unknown, ", "), currency)
+	}
+	return v, nil
+}
+
+// Currency returns the currency holdings are valued in.
+func (v *Valuer) Currency() string { return v.currency }
+
+// Pairs returns the keys of the pairs whose prices are needed to value every holding.
+func (v *Valuer) Pairs() []string {
+	seen := make(map[string]bool)
+	var pairs []string
+	for _, r := range v.routes {
+		for _, l := range r.legs {
+			if !seen[l.pair] {
+				seen[l.pair] = true
+				pairs = append(pairs, l.pair)
+			}
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// Path returns the assets asset is converted through, e.g. DOT/EUR/USD.
+func (v *Valuer) Path(asset string) string {
+	return strings.Join(v.routes[asset].path, "/")
+}
+
+// Update keeps the prices of the pairs in records which are needed by a route. The price
+// of a pair is its last trade price, or the mid price before the first trade is seen.
+func (v *Valuer) Update(records ...store.Record) {
+	for _, r := range records {
+		price := r.Last
+		if price.Sign() <= 0 && r.Bid.Sign() > 0 && r.Ask.Sign() > 0 {
+			// halving needs at most one more digit, so the mid price is exact
+			sum := r.Bid.Add(r.Ask)
+			price = sum.Quo(decimal.New(2, 0), sum.Scale()+1)
+		}
+		if price.Sign() <= 0 {
+			continue
+		}
+		v.prices[r.Pair] = price.Float64()
+	}
+}
+
+// AssetValue is the value of a holding.
+type AssetValue struct {
+	Asset    string
+	Quantity float64
+	// Price is the price of one unit of the asset in the valuation currency.
+	Price     float64
+	Value     float64
+	CostBasis float64
+	// PnL is the unrealized profit or loss, Value minus CostBasis, and PnLPercent is PnL as
+	// a percentage of CostBasis, 0 without a cost basis.
+	PnL        float64
+	PnLPercent float64
+	// Path lists the assets the holding is converted through, e.g. DOT/EUR/USD.
+	Path string
+}
+
+// Valuation is the value of every holding at Time.
+type Valuation struct {
+	Time     time.Time
+	Currency string
+	Assets   []AssetValue
+	// Total adds up every asset which could be valued, its Asset is empty.
+	Total AssetValue
+	// Missing lists the assets left out because a price in their route is not known yet.
+	Missing []string
+}
+
+// Value values the holdings at the latest prices.
+func (v *Valuer) Value(t time.Time) Valuation {
+	val := Valuation{Time: t, Currency: v.currency}
+	for _, h := range v.holdings {
+		r := v.routes[h.Asset]
+		price, ok := 1.0, true
+		for _, l := range r.legs {
+			p, known := v.prices[l.pair]
+			if !known {
+				ok = false
+				break
+			}
+			if l.invert {
+				p = 1 / p
+			}
+			price *= p
+		}
+		if !ok {
+			val.Missing = append(val.Missing, h.Asset)
+			continue
+		}
+
+		a := AssetValue{
+			Asset:     h.Asset,
+			Quantity:  h.Quantity,
+			Price:     price,
+			Value:     h.Quantity * price,
+			CostBasis: h.CostBasis,
+			Path:      strings.Join(r.path, "/"),
+		}
+		a.PnL, a.PnLPercent = pnl(a.Value, a.CostBasis)
+		val.Assets = append(val.Assets, a)
+		val.Total.Value += a.Value
+		val.Total.CostBasis += a.CostBasis
+	}
+	val.Total.PnL, val.Total.PnLPercent = pnl(val.Total.Value, val.Total.CostBasis)
+	return val
+}
+
+func pnl(value, costBasis float64) (float64, float64) {
+	if costBasis <= 0 {
+		return value - costBasis, 0
+	}
+	return value - costBasis, (value - costBasis) / costBasis * 100
+}
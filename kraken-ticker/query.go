@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1gm/x/internal/log"
+	"github.com/1gm/x/kraken-ticker/exchange"
+	"github.com/1gm/x/kraken-ticker/kraken"
+	"github.com/1gm/x/kraken-ticker/snapshot"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+type queryOptions struct {
+	directory string
+	pairs     string
+	from      string
+	to        string
+	interval  string
+	format    string
+	output    string
+}
+
+// intervals are the candle sizes accepted by query and backfill -interval, every one is
+// also served by the OHLC endpoint. Kraken's weekly and 15 day candles are left out as
+// they are aligned to the unix epoch rather than to time.Truncate's zero time.
+var intervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// intervalNames lists the keys of intervals for flag usage and errors.
+const intervalNames = "1m, 5m, 15m, 30m, 1h, 4h or 1d"
+
+// queryMain implements the query subcommand, which reads collected snapshots back out of
+// an output directory.
+func queryMain(args []string, stdout io.Writer) int {
+	var opts queryOptions
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	fs.StringVar(&opts.directory, "o", "data", "output directory of the collector")
+	fs.StringVar(&opts.pairs, "pairs", "", "comma separated pair keys to export, e.g. XXBTZUSD,XETHZUSD (defaults to all pairs)")
+	fs.StringVar(&opts.from, "from", "", "only export snapshots at or after this time, RFC3339 or yyyy-mm-dd")
+	fs.StringVar(&opts.to, "to", "", "only export snapshots before this time, RFC3339 or yyyy-mm-dd")
+	fs.StringVar(&opts.interval, "interval", "", "resample to OHLC candles of "+intervalNames+" instead of exporting snapshots")
+	fs.StringVar(&opts.format, "format", "csv", "export format, csv or json")
+	fs.StringVar(&opts.output, "out", "", "file to export to (defaults to stdout)")
+	fs.Parse(args)
+
+	log := log.New()
+	defer log.Sync()
+
+	from, err := parseQueryTime(opts.from)
+	if err != nil {
+		log.Errorf("invalid -from: %v", err)
+		return 1
+	}
+	to, err := parseQueryTime(opts.to)
+	if err != nil {
+		log.Errorf("invalid -to: %v", err)
+		return 1
+	}
+	var interval time.Duration
+	if opts.interval != "" {
+		var ok bool
+		if interval, ok = intervals[opts.interval]; !ok {
+			log.Errorf("invalid -interval %q, expected %s", opts.interval, intervalNames)
+			return 1
+		}
+	}
+	if opts.format != "csv" && opts.format != "json" {
+		log.Errorf("invalid -format %q, expected csv or json", opts.format)
+		return 1
+	}
+
+	var pairs []string
+	for _, p := range strings.Split(opts.pairs, ",") {
+		if p = strings.ToUpper(strings.TrimSpace(p)); p != "" {
+			pairs = append(pairs, p)
+		}
+	}
+
+	records, err := queryRecords(log, opts.directory, pairs, from, to)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	log.Infof("read %d snapshots", len(records))
+
+	out := stdout
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			log.Errorf("failed to create output file: %v", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	if interval > 0 {
+		var candles []store.Candle
+		if candles, err = queryCandles(opts.directory, pairs, records, interval, from, to); err != nil {
+			log.Error(err)
+			return 1
+		}
+		err = exportCandles(w, opts.format, candles)
+	} else {
+		err = exportRecords(w, opts.format, records)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Errorf("failed to export: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func parseQueryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// queryRecords reads the records for pairs, every pair when empty, in [from, to) from the
+// store in directory and any raw JSON responses saved with -raw. The result is sorted by
+// pair then time, snapshots found in both the store and a raw response are only returned
+// once.
+func queryRecords(log *zap.SugaredLogger, directory string, pairs []string, from, to time.Time) ([]store.Record, error) {
+	if _, err := os.Stat(directory); err != nil {
+		return nil, err
+	}
+	st, err := store.Open(filepath.Join(directory, "ticker"), store.CSV)
+	if err != nil {
+		return nil, err
+	}
+	want := make(map[string]bool)
+	for _, p := range pairs {
+		want[p] = true
+	}
+	if len(pairs) == 0 {
+		if pairs, err = st.Pairs(); err != nil {
+			return nil, fmt.Errorf("failed to list pairs: %v", err)
+		}
+	}
+
+	type key struct {
+		pair string
+		time int64
+	}
+	seen := make(map[key]bool)
+	records := []store.Record{}
+	add := func(r store.Record) {
+		k := key{r.Pair, r.Time.UnixNano()}
+		if !seen[k] {
+			seen[k] = true
+			records = append(records, r)
+		}
+	}
+
+	for _, pair := range pairs {
+		rs, err := st.Query(pair, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", pair, err)
+		}
+		for _, r := range rs {
+			add(r)
+		}
+	}
+
+	err = readRawResponses(log, directory, from, to, func(t time.Time, tickers map[string]kraken.Ticker) {
+		for pair, ticker := range tickers {
+			if len(want) > 0 && !want[pair] {
+				continue
+			}
+			add(recordFromQuote(t, exchange.KrakenQuote(t, pair, "", ticker)))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Pair != records[j].Pair {
+			return records[i].Pair < records[j].Pair
+		}
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, nil
+}
+
+// queryCandles resamples records into candles, using the candles saved for days whose
+// snapshots were removed by -retain instead when they were saved at the same interval.
+// Saved candles were built from every snapshot of their day, so they replace candles
+// built from the raw responses which are kept longer.
+func queryCandles(directory string, pairs []string, records []store.Record, interval time.Duration, from, to time.Time) ([]store.Candle, error) {
+	st, err := store.Open(filepath.Join(directory, "ticker"), store.CSV)
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		if pairs, err = st.Pairs(); err != nil {
+			return nil, fmt.Errorf("failed to list pairs: %v", err)
+		}
+	}
+
+	type key struct {
+		pair string
+		time int64
+	}
+	var candles []store.Candle
+	saved := make(map[key]bool)
+	for _, pair := range pairs {
+		cs, err := st.Candles(pair, interval, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cs {
+			saved[key{c.Pair, c.Time.Unix()}] = true
+		}
+		candles = append(candles, cs...)
+	}
+	for _, c := range store.Resample(records, interval) {
+		if !saved[key{c.Pair, c.Time.Unix()}] {
+			candles = append(candles, c)
+		}
+	}
+
+	sort.SliceStable(candles, func(i, j int) bool {
+		if candles[i].Pair != candles[j].Pair {
+			return candles[i].Pair < candles[j].Pair
+		}
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return candles, nil
+}
+
+// readRawResponses calls fn with each raw Ticker response in directory saved within
+// [from, to), delta encoded responses are rebuilt in full.
+func readRawResponses(log *zap.SugaredLogger, directory string, from, to time.Time, fn func(t time.Time, tickers map[string]kraken.Ticker)) error {
+	r, err := snapshot.OpenReader(directory, from, to)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for {
+		snap, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		tickers := make(map[string]kraken.Ticker, len(snap.Pairs))
+		for pair, raw := range snap.Pairs {
+			var ticker kraken.Ticker
+			if err = json.Unmarshal(raw, &ticker); err != nil {
+				return fmt.Errorf("failed to decode %s at %s: %v", pair, snap.Time.Format(time.RFC3339), err)
+			}
+			tickers[pair] = ticker
+		}
+		fn(snap.Time, tickers)
+	}
+	for _, name := range r.Skipped() {
+		log.Warnf("skipped %s, its base response is missing", name)
+	}
+	return nil
+}
+
+func exportRecords(w io.Writer, format string, records []store.Record) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(records)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"time", "pair", "ask", "bid", "last", "last_volume", "volume_today", "volume_24h",
+		"vwap_today", "vwap_24h", "low_24h", "high_24h", "open", "trades_today", "trades_24h",
+	})
+	for _, r := range records {
+		cw.Write([]string{
+			r.Time.UTC().Format(time.RFC3339Nano), r.Pair,
+			r.Ask.String(), r.Bid.String(), r.Last.String(), r.LastVolume.String(),
+			r.VolumeToday.String(), r.Volume24h.String(), r.VWAPToday.String(), r.VWAP24h.String(),
+			r.Low24h.String(), r.High24h.String(), r.Open.String(),
+			strconv.FormatInt(r.TradesToday, 10), strconv.FormatInt(r.Trades24h, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportCandles(w io.Writer, format string, candles []store.Candle) error {
+	if format == "json" {
+		if candles == nil {
+			candles = []store.Candle{}
+		}
+		return json.NewEncoder(w).Encode(candles)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "pair", "open", "high", "low", "close", "volume", "samples"})
+	for _, c := range candles {
+		cw.Write([]string{
+			c.Time.UTC().Format(time.RFC3339), c.Pair,
+			formatFloat(c.Open), formatFloat(c.High), formatFloat(c.Low), formatFloat(c.Close),
+			formatFloat(c.Volume), strconv.Itoa(c.Samples),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
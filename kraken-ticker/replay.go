@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/1gm/x/internal/log"
+	"github.com/1gm/x/kraken-ticker/snapshot"
+)
+
+// replayMain implements the replay subcommand, which writes the raw responses saved with
+// -raw as JSON lines, rebuilding delta encoded responses in full.
+func replayMain(args []string, stdout io.Writer) int {
+	var directory, from, to, output string
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.StringVar(&directory, "o", "data", "output directory of the collector")
+	fs.StringVar(&from, "from", "", "only replay responses at or after this time, RFC3339 or yyyy-mm-dd")
+	fs.StringVar(&to, "to", "", "only replay responses before this time, RFC3339 or yyyy-mm-dd")
+	fs.StringVar(&output, "out", "", "file to write to (defaults to stdout)")
+	fs.Parse(args)
+
+	log := log.New()
+	defer log.Sync()
+
+	fromTime, err := parseQueryTime(from)
+	if err != nil {
+		log.Errorf("invalid -from: %v", err)
+		return 1
+	}
+	toTime, err := parseQueryTime(to)
+	if err != nil {
+		log.Errorf("invalid -to: %v", err)
+		return 1
+	}
+
+	r, err := snapshot.OpenReader(directory, fromTime, toTime)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	defer r.Close()
+
+	out := stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Errorf("failed to create output file: %v", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	n := 0
+	for {
+		snap, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			log.Error(err)
+			return 1
+		}
+		if err = enc.Encode(snap); err != nil {
+			log.Errorf("failed to write: %v", err)
+			return 1
+		}
+		n++
+	}
+	if err = w.Flush(); err != nil {
+		log.Errorf("failed to write: %v", err)
+		return 1
+	}
+	for _, name := range r.Skipped() {
+		log.Warnf("skipped %s, its base response is missing", name)
+	}
+	log.Infof("replayed %d responses", n)
+	return 0
+}
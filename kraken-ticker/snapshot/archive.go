@@ -0,0 +1,346 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveDir is the directory, within a snapshot directory, daily archives are saved to.
+const ArchiveDir = "archive"
+
+const manifestName = "manifest.json"
+
+// Manifest lists the files in a daily archive, it is the archive's first entry.
+type Manifest struct {
+	Day     string         `json:"day"`
+	Created time.Time      `json:"created"`
+	Files   []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file in an archive.
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Days returns the days, as yyyy-mm-dd in UTC, with snapshot files which have not been
+// archived yet.
+func Days(dir string) ([]string, error) {
+	files, err := list(dir)
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, f := range files {
+		day := f.time.UTC().Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1] != day {
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+// Archive bundles the snapshot files of day into <dir>/archive/<day>.tar.gz and removes
+// them. The archive starts with a manifest of every file's size and SHA-256 and the
+// archive's own SHA-256 is written next to it to <day>.tar.gz.sha256, in the format read
+// by sha256sum -c.
+func Archive(dir, day string) (Manifest, error) {
+	files, err := list(dir)
+	if err != nil {
+		return Manifest{}, err
+	}
+	m := Manifest{Day: day, Created: time.Now().UTC()}
+	var names []string
+	for _, f := range files {
+		if f.time.UTC().Format("2006-01-02") != day {
+			continue
+		}
+		mf, err := checksum(f.name)
+		if err != nil {
+			return Manifest{}, err
+		}
+		m.Files = append(m.Files, mf)
+		names = append(names, f.name)
+	}
+	if len(names) == 0 {
+		return m, nil
+	}
+
+	archiveDir := filepath.Join(dir, ArchiveDir)
+	if err = os.MkdirAll(archiveDir, 0755); err != nil {
+		return Manifest{}, err
+	}
+	// a day is normally archived once, a second archive only happens when files for a
+	// past day show up later, e.g. after the clock was changed
+	filename := filepath.Join(archiveDir, day+".tar.gz")
+	for i := 1; fileExists(filename); i++ {
+		filename = filepath.Join(archiveDir, fmt.Sprintf("%s.%d.tar.gz", day, i))
+	}
+
+	sum, err := writeArchive(filename, m, names)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to archive %s: %v", day, err)
+	}
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(filename))
+	if err = os.WriteFile(filename+".sha256", []byte(line), 0644); err != nil {
+		return Manifest{}, fmt.Errorf("failed to archive %s: %v", day, err)
+	}
+
+	for _, name := range names {
+		if err = os.Remove(name); err != nil {
+			return Manifest{}, err
+		}
+	}
+	return m, nil
+}
+
+// writeArchive writes the tar.gz archive of m and the files names and returns its SHA-256.
+// The archive is written to a temporary file first so a crash never leaves a partial
+// archive behind while the files are removed.
+func writeArchive(filename string, m Manifest, names []string) (string, error) {
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	h := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, h))
+	tw := tar.NewWriter(gz)
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	hdr := &tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(b)), ModTime: m.Created}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return "", err
+	}
+	if _, err = tw.Write(b); err != nil {
+		return "", err
+	}
+
+	for i, name := range names {
+		if err = addFile(tw, name, m.Files[i].Size); err != nil {
+			return "", err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return "", err
+	}
+	if err = gz.Close(); err != nil {
+		return "", err
+	}
+	if err = f.Sync(); err != nil {
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp, filename); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func addFile(tw *tar.Writer, name string, size int64) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != size {
+		return fmt.Errorf("%s changed while archiving", name)
+	}
+
+	hdr := &tar.Header{Name: filepath.Base(name), Mode: 0644, Size: size, ModTime: fi.ModTime()}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func checksum(name string) (ManifestFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	return ManifestFile{Name: filepath.Base(name), Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// listArchives returns the files in the daily archives of dir, using each archive's
+// manifest.
+func listArchives(dir string) ([]file, error) {
+	archives, err := filepath.Glob(filepath.Join(dir, ArchiveDir, "*.tar.gz"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(archives)
+
+	var files []file
+	for _, archive := range archives {
+		m, err := readManifest(archive)
+		if err != nil {
+			return nil, err
+		}
+		for _, mf := range m.Files {
+			if f, ok := parseFileName(mf.Name); ok {
+				f.name, f.archive = mf.Name, archive
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+func readManifest(archive string) (Manifest, error) {
+	a, err := openArchive(archive)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer a.Close()
+
+	var m Manifest
+	hdr, err := a.tr.Next()
+	if err == nil && hdr.Name != manifestName {
+		err = fmt.Errorf("first entry is %s, expected %s", hdr.Name, manifestName)
+	}
+	if err == nil {
+		err = json.NewDecoder(a.tr).Decode(&m)
+	}
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to read manifest of %s: %v", archive, err)
+	}
+	return m, nil
+}
+
+// archiveReader reads the entries of a tar.gz archive in order.
+type archiveReader struct {
+	name string
+	f    *os.File
+	gz   *gzip.Reader
+	tr   *tar.Reader
+}
+
+func openArchive(name string) (*archiveReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	return &archiveReader{name: name, f: f, gz: gz, tr: tar.NewReader(gz)}, nil
+}
+
+// seek advances to the entry called name, which must come after the current entry.
+func (a *archiveReader) seek(name string) (io.Reader, error) {
+	for {
+		hdr, err := a.tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", name, a.name)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", a.name, err)
+		}
+		if hdr.Name == name {
+			return a.tr, nil
+		}
+	}
+}
+
+func (a *archiveReader) Close() error {
+	a.gz.Close()
+	return a.f.Close()
+}
+
+// Prune removes the snapshot files and archives of days before the day before, given as
+// yyyy-mm-dd, and returns the names of the files removed.
+func Prune(dir, before string) ([]string, error) {
+	files, err := list(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, f := range files {
+		if f.time.UTC().Format("2006-01-02") >= before {
+			break
+		}
+		if err = os.Remove(f.name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, f.name)
+	}
+
+	archives, err := filepath.Glob(filepath.Join(dir, ArchiveDir, "*.tar.gz"))
+	if err != nil {
+		return removed, err
+	}
+	for _, archive := range archives {
+		// archives are named <day>.tar.gz or <day>.<n>.tar.gz
+		if day := filepath.Base(archive); len(day) < len(before) || day[:len(before)] >= before {
+			continue
+		}
+		if err = os.Remove(archive); err != nil {
+			return removed, err
+		}
+		if err = os.Remove(archive + ".sha256"); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, archive)
+	}
+	return removed, nil
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// parseFileName parses the time and encoding of a snapshot file from its name, names
+// written before fileLayout used RFC 3339 and are still read.
+func parseFileName(name string) (file, bool) {
+	c, base := compressionOf(name)
+	if !strings.HasSuffix(base, ".json") {
+		return file{}, false
+	}
+	base = strings.TrimSuffix(base, ".json")
+	isDelta := strings.HasSuffix(base, ".delta")
+	base = strings.TrimSuffix(base, ".delta")
+	t, err := time.Parse(fileLayout, base)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, base)
+	}
+	if err != nil {
+		// not a snapshot, e.g. gaps.jsonl
+		return file{}, false
+	}
+	return file{time: t, delta: isDelta, compression: c}, true
+}
@@ -0,0 +1,86 @@
+// Package snapshot saves raw Ticker responses, one file per poll, and replays them.
+// Files can be compressed with gzip or zstd and delta encoded so only the pairs which
+// changed since the previous snapshot are stored.
+package snapshot
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression applied to snapshot files.
+type Compression string
+
+const (
+	None Compression = "none"
+	Gzip Compression = "gzip"
+	Zstd Compression = "zstd"
+)
+
+// ParseCompression parses a Compression, an empty string is None.
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(strings.ToLower(s)); c {
+	case "":
+		return None, nil
+	case None, Gzip, Zstd:
+		return c, nil
+	}
+	return "", fmt.Errorf("invalid compression %q, expected none, gzip or zstd", s)
+}
+
+// Ext returns the file extension added by c, e.g. ".gz".
+func (c Compression) Ext() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// NewWriter returns a writer compressing to w, closing it flushes the compressed stream
+// but does not close w.
+func (c Compression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+// NewReader returns a reader decompressing r, closing it does not close r.
+func (c Compression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// compressionOf returns the compression of filename from its extension and the name
+// without it.
+func compressionOf(filename string) (Compression, string) {
+	for _, c := range []Compression{Gzip, Zstd} {
+		if strings.HasSuffix(filename, c.Ext()) {
+			return c, strings.TrimSuffix(filename, c.Ext())
+		}
+	}
+	return None, filename
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
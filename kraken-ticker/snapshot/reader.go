@@ -0,0 +1,190 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// file is a snapshot file found in a directory or in one of its archives.
+type file struct {
+	name        string
+	time        time.Time
+	delta       bool
+	compression Compression
+	// archive is the daily archive containing the file, empty when it is not archived.
+	archive string
+}
+
+// list returns the snapshot files in dir which have not been archived sorted by time,
+// other files are ignored.
+func list(dir string) ([]file, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %v", err)
+	}
+	var files []file
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if f, ok := parseFileName(e.Name()); ok {
+			f.name = filepath.Join(dir, e.Name())
+			files = append(files, f)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].time.Before(files[j].time) })
+	return files, nil
+}
+
+// Reader replays the snapshots saved in a directory, including its daily archives, in
+// time order. Delta encoded snapshots are returned in full.
+type Reader struct {
+	files    []file
+	from, to time.Time
+	// archive is the daily archive being read, files in an archive are read in order
+	archive *archiveReader
+
+	current     map[string]json.RawMessage
+	currentTime time.Time
+	skipped     []string
+}
+
+// OpenReader opens the snapshots in dir saved within [from, to), a zero from or to leaves
+// that end of the range open.
+func OpenReader(dir string, from, to time.Time) (*Reader, error) {
+	files, err := listArchives(dir)
+	if err != nil {
+		return nil, err
+	}
+	loose, err := list(dir)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, loose...)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].time.Before(files[j].time) })
+
+	// deltas before from are still needed to rebuild the first snapshot in range, start
+	// at the last full snapshot before it
+	start := 0
+	for i, f := range files {
+		if !from.IsZero() && !f.time.After(from) && !f.delta {
+			start = i
+		}
+	}
+	end := len(files)
+	if !to.IsZero() {
+		end = sort.Search(len(files), func(i int) bool { return !files[i].time.Before(to) })
+	}
+	if end < start {
+		end = start
+	}
+	return &Reader{files: files[start:end], from: from, to: to}, nil
+}
+
+// Next returns the next snapshot, io.EOF after the last one. Deltas whose base snapshot
+// is missing cannot be rebuilt, they are skipped up to the next full snapshot, see
+// Skipped.
+func (r *Reader) Next() (Snapshot, error) {
+	for len(r.files) > 0 {
+		f := r.files[0]
+		r.files = r.files[1:]
+
+		if !f.delta {
+			var resp struct {
+				Result map[string]json.RawMessage `json:"result"`
+			}
+			if err := r.readJSON(f, &resp); err != nil {
+				return Snapshot{}, err
+			}
+			r.current, r.currentTime = resp.Result, f.time
+		} else {
+			var d delta
+			if err := r.readJSON(f, &d); err != nil {
+				return Snapshot{}, err
+			}
+			if r.current == nil || !d.Base.Equal(r.currentTime) {
+				r.current = nil
+				if f.archive != "" {
+					r.skipped = append(r.skipped, f.archive+":"+f.name)
+				} else {
+					r.skipped = append(r.skipped, f.name)
+				}
+				continue
+			}
+			next := make(map[string]json.RawMessage, len(r.current)+len(d.Changed))
+			for pair, ticker := range r.current {
+				next[pair] = ticker
+			}
+			for pair, ticker := range d.Changed {
+				next[pair] = ticker
+			}
+			for _, pair := range d.Removed {
+				delete(next, pair)
+			}
+			r.current, r.currentTime = next, f.time
+		}
+
+		if !r.from.IsZero() && f.time.Before(r.from) {
+			continue
+		}
+		pairs := make(map[string]json.RawMessage, len(r.current))
+		for pair, ticker := range r.current {
+			pairs[pair] = ticker
+		}
+		return Snapshot{Time: f.time, Pairs: pairs}, nil
+	}
+	return Snapshot{}, io.EOF
+}
+
+// Skipped returns the delta files which could not be rebuilt so far.
+func (r *Reader) Skipped() []string { return r.skipped }
+
+// Close closes the archive being read, if any.
+func (r *Reader) Close() error {
+	if r.archive == nil {
+		return nil
+	}
+	err := r.archive.Close()
+	r.archive = nil
+	return err
+}
+
+func (r *Reader) readJSON(f file, v interface{}) error {
+	var src io.Reader
+	if f.archive == "" {
+		fd, err := os.Open(f.name)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		src = fd
+	} else {
+		if r.archive == nil || r.archive.name != f.archive {
+			r.Close()
+			a, err := openArchive(f.archive)
+			if err != nil {
+				return err
+			}
+			r.archive = a
+		}
+		var err error
+		if src, err = r.archive.seek(f.name); err != nil {
+			return err
+		}
+	}
+
+	cr, err := f.compression.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", f.name, err)
+	}
+	defer cr.Close()
+	if err = json.NewDecoder(cr).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", f.name, err)
+	}
+	return nil
+}
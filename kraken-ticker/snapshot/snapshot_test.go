@@ -0,0 +1,228 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 23, 56, 0, 0, time.UTC)
+
+// sequence returns n Ticker responses a minute apart from start, crossing midnight after
+// the fourth. XXBTZUSD changes every minute, XETHZUSD every other minute, DOTUSD is removed
+// after the second and SOLUSD added at the sixth.
+func sequence(n int) []map[string]string {
+	var responses []map[string]string
+	for i := 0; i < n; i++ {
+		pairs := map[string]string{
+			"XXBTZUSD": fmt.Sprintf(`{"c": ["%d.1", "0.5"], "t": [%d, 100]}`, 30000+i, i),
+			"XETHZUSD": fmt.Sprintf(`{"c": ["%d.0", "1.0"]}`, 2000+i/2),
+		}
+		if i < 2 {
+			pairs["DOTUSD"] = `{"c": ["5.0", "10"]}`
+		}
+		if i >= 5 {
+			pairs["SOLUSD"] = `{"c": ["20.0", "2"]}`
+		}
+		responses = append(responses, pairs)
+	}
+	return responses
+}
+
+// response encodes pairs as a Ticker response body, indented like the ones Kraken sends.
+func response(pairs map[string]string) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"error": [], "result": {`)
+	names := make([]string, 0, len(pairs))
+	for pair := range pairs {
+		names = append(names, pair)
+	}
+	sort.Strings(names)
+	for i, pair := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "\n  %q: %s", pair, pairs[pair])
+	}
+	b.WriteString("}}")
+	return b.Bytes()
+}
+
+// write saves responses with w and returns the names of the files written.
+func write(t *testing.T, w *Writer, responses []map[string]string) []string {
+	t.Helper()
+	var names []string
+	for i, pairs := range responses {
+		name, err := w.Write(start.Add(time.Duration(i)*time.Minute+time.Millisecond), response(pairs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// readAll returns every snapshot in dir within [from, to) as "<time> <pair>=<ticker>..."
+// lines with compacted tickers, as deltas store them.
+func readAll(t *testing.T, dir string, from, to time.Time) ([]string, []string) {
+	t.Helper()
+	r, err := OpenReader(dir, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got []string
+	for {
+		snap, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		pairs := make(map[string]string)
+		for pair, ticker := range snap.Pairs {
+			pairs[pair] = string(ticker)
+		}
+		got = append(got, format(snap.Time, pairs))
+	}
+	return got, r.Skipped()
+}
+
+func format(t time.Time, pairs map[string]string) string {
+	names := make([]string, 0, len(pairs))
+	for pair := range pairs {
+		names = append(names, pair)
+	}
+	sort.Strings(names)
+	line := t.UTC().Format(time.RFC3339)
+	for _, pair := range names {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(pairs[pair])); err != nil {
+			panic(err)
+		}
+		line += " " + pair + "=" + buf.String()
+	}
+	return line
+}
+
+func want(responses []map[string]string, from, to int) []string {
+	var lines []string
+	for i := from; i < to; i++ {
+		lines = append(lines, format(start.Add(time.Duration(i)*time.Minute), responses[i]))
+	}
+	return lines
+}
+
+func check(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("%s: got\n%s\nwant\n%s", name, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReaderDelta(t *testing.T) {
+	responses := sequence(8)
+	minute := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+
+	for _, c := range []Compression{None, Gzip, Zstd} {
+		c := c
+		t.Run(string(c), func(t *testing.T) {
+			dir := t.TempDir()
+			names := write(t, NewWriter(dir, WithCompression(c), WithDelta(3)), responses)
+
+			// a full snapshot every third, and at the first of each day
+			full := map[int]bool{0: true, 3: true, 4: true, 7: true}
+			for i, name := range names {
+				wantName := fileName(minute(i), !full[i], c)
+				if filepath.Base(name) != wantName {
+					t.Errorf("snapshot %d: got file %s, want %s", i, filepath.Base(name), wantName)
+				}
+			}
+
+			got, skipped := readAll(t, dir, time.Time{}, time.Time{})
+			check(t, "every snapshot", got, want(responses, 0, 8))
+			if len(skipped) > 0 {
+				t.Errorf("skipped %v", skipped)
+			}
+
+			// reading from a delta rebuilds it from the full snapshot before it
+			got, _ = readAll(t, dir, minute(2), time.Time{})
+			check(t, "from a delta", got, want(responses, 2, 8))
+			got, _ = readAll(t, dir, minute(5).Add(30*time.Second), time.Time{})
+			check(t, "after the last full snapshot", got, want(responses, 6, 8))
+			got, _ = readAll(t, dir, minute(1), minute(3))
+			check(t, "within a range", got, want(responses, 1, 3))
+		})
+	}
+}
+
+func TestReaderRFC3339Names(t *testing.T) {
+	responses := sequence(8)
+	dir := t.TempDir()
+	names := write(t, NewWriter(dir, WithCompression(Gzip), WithDelta(3)), responses)
+
+	// earlier versions named files with RFC 3339 times, rename the first day's files so
+	// both kinds of name are read in a single sequence
+	for _, name := range names[:4] {
+		f, ok := parseFileName(filepath.Base(name))
+		if !ok {
+			t.Fatalf("%s is not a snapshot file", name)
+		}
+		old := f.time.Format(time.RFC3339) + strings.TrimPrefix(filepath.Base(name), f.time.Format(fileLayout))
+		if err := os.Rename(name, filepath.Join(dir, old)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, skipped := readAll(t, dir, time.Time{}, time.Time{})
+	check(t, "every snapshot", got, want(responses, 0, 8))
+	if len(skipped) > 0 {
+		t.Errorf("skipped %v", skipped)
+	}
+	got, _ = readAll(t, dir, start.Add(2*time.Minute), time.Time{})
+	check(t, "from a delta", got, want(responses, 2, 8))
+}
+
+func TestReaderMissingBase(t *testing.T) {
+	responses := sequence(8)
+	dir := t.TempDir()
+	names := write(t, NewWriter(dir, WithDelta(3)), responses)
+	if err := os.Remove(names[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, skipped := readAll(t, dir, time.Time{}, time.Time{})
+	check(t, "every snapshot", got, want(responses, 3, 8))
+	if len(skipped) != 2 || skipped[0] != names[1] || skipped[1] != names[2] {
+		t.Errorf("got skipped %v, want %v", skipped, names[1:3])
+	}
+}
+
+func TestReaderArchive(t *testing.T) {
+	responses := sequence(8)
+	dir := t.TempDir()
+	write(t, NewWriter(dir, WithCompression(Zstd), WithDelta(3)), responses)
+	m, err := Archive(dir, "2024-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 4 {
+		t.Errorf("archived %d files, want 4", len(m.Files))
+	}
+
+	got, skipped := readAll(t, dir, time.Time{}, time.Time{})
+	check(t, "every snapshot", got, want(responses, 0, 8))
+	if len(skipped) > 0 {
+		t.Errorf("skipped %v", skipped)
+	}
+	got, _ = readAll(t, dir, start.Add(2*time.Minute), start.Add(6*time.Minute))
+	check(t, "across the archive", got, want(responses, 2, 6))
+}
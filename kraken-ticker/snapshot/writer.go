@@ -0,0 +1,154 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Snapshot is a Ticker response, the raw ticker of each pair keyed by pair.
+type Snapshot struct {
+	Time  time.Time                  `json:"time"`
+	Pairs map[string]json.RawMessage `json:"result"`
+}
+
+// delta is the content of a delta encoded file, the pairs which changed since the
+// snapshot saved at Base.
+type delta struct {
+	Base    time.Time                  `json:"base"`
+	Changed map[string]json.RawMessage `json:"result"`
+	Removed []string                   `json:"removed,omitempty"`
+}
+
+// Writer saves snapshots to a directory as <time>.json, or <time>.delta.json for delta
+// encoded snapshots, followed by the compression's extension.
+type Writer struct {
+	dir         string
+	compression Compression
+	// keyframe is the number of snapshots from one full snapshot to the next when delta
+	// encoding, 0 when every snapshot is saved in full.
+	keyframe int
+
+	prev     map[string]json.RawMessage
+	prevTime time.Time
+	deltas   int
+}
+
+// Option configures a Writer.
+type Option func(*Writer)
+
+// WithCompression compresses every file with c.
+func WithCompression(c Compression) Option { return func(w *Writer) { w.compression = c } }
+
+// WithDelta only saves the pairs which changed since the previous snapshot. Every
+// keyframe snapshots, and at the first snapshot of each UTC day, the full snapshot is
+// saved so a day can be replayed on its own and a lost file only breaks one run of
+// deltas.
+func WithDelta(keyframe int) Option { return func(w *Writer) { w.keyframe = keyframe } }
+
+// NewWriter creates a Writer saving uncompressed full snapshots to dir.
+func NewWriter(dir string, opts ...Option) *Writer {
+	w := &Writer{dir: dir, compression: None}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Write saves the Ticker response raw fetched at t, truncated to the second, and returns
+// the name of the file written. Full snapshots are saved as received from Kraken.
+func (w *Writer) Write(t time.Time, raw []byte) (string, error) {
+	t = t.UTC().Truncate(time.Second)
+	if w.keyframe <= 0 {
+		return w.write(t, false, raw)
+	}
+
+	var resp struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+	pairs := make(map[string]json.RawMessage, len(resp.Result))
+	for pair, ticker := range resp.Result {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, ticker); err != nil {
+			return "", fmt.Errorf("failed to decode %s: %v", pair, err)
+		}
+		pairs[pair] = buf.Bytes()
+	}
+
+	if w.prev == nil || w.deltas+1 >= w.keyframe || !sameDay(t, w.prevTime) {
+		filename, err := w.write(t, false, raw)
+		if err != nil {
+			return "", err
+		}
+		w.prev, w.prevTime, w.deltas = pairs, t, 0
+		return filename, nil
+	}
+
+	d := delta{Base: w.prevTime, Changed: make(map[string]json.RawMessage)}
+	for pair, ticker := range pairs {
+		if !bytes.Equal(w.prev[pair], ticker) {
+			d.Changed[pair] = ticker
+		}
+	}
+	for pair := range w.prev {
+		if _, ok := pairs[pair]; !ok {
+			d.Removed = append(d.Removed, pair)
+		}
+	}
+	sort.Strings(d.Removed)
+	b, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	filename, err := w.write(t, true, b)
+	if err != nil {
+		return "", err
+	}
+	w.prev, w.prevTime = pairs, t
+	w.deltas++
+	return filename, nil
+}
+
+func (w *Writer) write(t time.Time, isDelta bool, b []byte) (string, error) {
+	filename := filepath.Join(w.dir, fileName(t, isDelta, w.compression))
+
+	var buf bytes.Buffer
+	cw, err := w.compression.NewWriter(&buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to compress %s: %v", filename, err)
+	}
+	if _, err = cw.Write(b); err == nil {
+		err = cw.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to compress %s: %v", filename, err)
+	}
+
+	if err = os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to save %s: %v", filename, err)
+	}
+	return filename, nil
+}
+
+// fileLayout names snapshot files without the colons of RFC 3339, which are not allowed
+// in Windows file names, e.g. 20230706T120000Z.json.
+const fileLayout = "20060102T150405Z"
+
+func fileName(t time.Time, isDelta bool, c Compression) string {
+	name := t.UTC().Format(fileLayout)
+	if isDelta {
+		name += ".delta"
+	}
+	return name + ".json" + c.Ext()
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.UTC().Format("2006-01-02") == b.UTC().Format("2006-01-02")
+}
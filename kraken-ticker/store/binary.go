@@ -0,0 +1,155 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+)
+
+// binaryMagic starts every binary file, the final byte is the format version.
+var binaryMagic = []byte{'K', 'T', 'R', 1}
+
+// binaryRecordSize is the size of a binary row: the time in unix nanoseconds followed by
+// each decimal column as an int64 coefficient and a scale byte, see binaryDecimal, and
+// each int column, all little endian. Rows are fixed size so a time range can be found
+// with a binary search.
+var binaryRecordSize = 8*len(columns) + len(new(Record).decimals())
+
+// validBinarySize returns the size of a binary file of size bytes without a partially
+// written header or final row.
+func validBinarySize(size int64) int64 {
+	header := int64(len(binaryMagic))
+	if size < header {
+		return 0
+	}
+	return header + (size-header)/int64(binaryRecordSize)*int64(binaryRecordSize)
+}
+
+func writeBinary(w io.Writer, records []Record, header bool) error {
+	var buf bytes.Buffer
+	if header {
+		buf.Write(binaryMagic)
+	}
+	var b [8]byte
+	for i := range records {
+		r := &records[i]
+		binary.LittleEndian.PutUint64(b[:], uint64(r.Time.UnixNano()))
+		buf.Write(b[:])
+		for n, d := range r.decimals() {
+			coef, scale, err := binaryDecimal(*d)
+			if err != nil {
+				return fmt.Errorf("invalid %s %s: %v", columns[n+1], d, err)
+			}
+			binary.LittleEndian.PutUint64(b[:], uint64(coef))
+			buf.Write(b[:])
+			buf.WriteByte(scale)
+		}
+		for _, v := range r.ints() {
+			binary.LittleEndian.PutUint64(b[:], uint64(*v))
+			buf.Write(b[:])
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readBinary(r io.ReadSeeker, pair string, from, to time.Time) ([]Record, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var magic [4]byte
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(r, magic[:]); err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	} else if !bytes.Equal(magic[:], binaryMagic) {
+		return nil, fmt.Errorf("invalid header %x", magic)
+	}
+
+	// a partially written final row is ignored, it is removed before the next append
+	n := int((size - int64(len(binaryMagic))) / int64(binaryRecordSize))
+	row := make([]byte, binaryRecordSize)
+	readRow := func(i int) ([]byte, error) {
+		if _, err := r.Seek(int64(len(binaryMagic)+i*binaryRecordSize), io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, err
+		}
+		return row, nil
+	}
+
+	var searchErr error
+	start := 0
+	if !from.IsZero() {
+		start = sort.Search(n, func(i int) bool {
+			row, err := readRow(i)
+			if err != nil {
+				searchErr = err
+				return true
+			}
+			return int64(binary.LittleEndian.Uint64(row)) >= from.UnixNano()
+		})
+		if searchErr != nil {
+			return nil, searchErr
+		}
+	}
+
+	if _, err = r.Seek(int64(len(binaryMagic)+start*binaryRecordSize), io.SeekStart); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	var records []Record
+	for i := start; i < n; i++ {
+		if _, err = io.ReadFull(br, row); err != nil {
+			return nil, err
+		}
+		rec := decodeBinaryRow(row, pair)
+		if !to.IsZero() && !rec.Time.Before(to) {
+			break
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func decodeBinaryRow(row []byte, pair string) Record {
+	rec := Record{Pair: pair, Time: time.Unix(0, int64(binary.LittleEndian.Uint64(row))).UTC()}
+	n := 8
+	for _, d := range rec.decimals() {
+		*d = decimal.New(int64(binary.LittleEndian.Uint64(row[n:])), int32(row[n+8]))
+		n += 9
+	}
+	for _, v := range rec.ints() {
+		*v = int64(binary.LittleEndian.Uint64(row[n:]))
+		n += 8
+	}
+	return rec
+}
+
+// binaryDecimal returns the coefficient and scale d is stored as. Digits after the decimal
+// point are rounded away until both fit, which only loses precision far beyond any price
+// or volume Kraken sends.
+func binaryDecimal(d decimal.Decimal) (int64, byte, error) {
+	if d.Scale() > math.MaxUint8 {
+		d = d.Round(math.MaxUint8)
+	}
+	for {
+		if coef := d.Coefficient(); coef.IsInt64() {
+			return coef.Int64(), byte(d.Scale()), nil
+		}
+		if d.Scale() == 0 {
+			return 0, 0, fmt.Errorf("too large for the binary format")
+		}
+		d = d.Round(d.Scale() - 1)
+	}
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var candleColumns = []string{"time", "open", "high", "low", "close", "volume", "samples"}
+
+// candleFile is <dir>/<pair>/candles-<interval>.csv, e.g. candles-1h.csv.
+func (s *Store) candleFile(pair string, interval time.Duration) string {
+	return filepath.Join(s.pairDir(pair), "candles-"+IntervalName(interval)+".csv")
+}
+
+// IntervalName formats interval in the largest whole unit of days, hours, minutes or
+// seconds, e.g. 1d, 4h or 5m.
+func IntervalName(interval time.Duration) string {
+	switch {
+	case interval%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", interval/(24*time.Hour))
+	case interval%time.Hour == 0:
+		return fmt.Sprintf("%dh", interval/time.Hour)
+	case interval%time.Minute == 0:
+		return fmt.Sprintf("%dm", interval/time.Minute)
+	}
+	return fmt.Sprintf("%ds", interval/time.Second)
+}
+
+// MergeCandles saves the candles of pair to <pair>/candles-<interval>.csv, keeping the
+// file in time order, and returns the number of candles added. Candles for an interval
+// which is already saved are skipped. Candles are kept when the daily files they were
+// built from are removed, see RemoveDay.
+func (s *Store) MergeCandles(pair string, interval time.Duration, candles []Candle) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filename := s.candleFile(pair, interval)
+	saved, err := readCandles(filename, pair, time.Time{}, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	exists := make(map[int64]bool, len(saved))
+	var last time.Time
+	for _, c := range saved {
+		exists[c.Time.Unix()] = true
+		if c.Time.After(last) {
+			last = c.Time
+		}
+	}
+	// candles after the last saved candle are appended, the file is only rewritten when
+	// filling in earlier intervals, e.g. with backfill
+	var fresh []Candle
+	inOrder := true
+	for _, c := range candles {
+		if exists[c.Time.Unix()] {
+			continue
+		}
+		exists[c.Time.Unix()] = true
+		fresh = append(fresh, c)
+		if !c.Time.After(last) {
+			inOrder = false
+		} else {
+			last = c.Time
+		}
+	}
+	if len(fresh) == 0 {
+		return 0, nil
+	}
+
+	if err = os.MkdirAll(s.pairDir(pair), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create pair directory: %v", err)
+	}
+	if inOrder {
+		err = appendCandles(filename, fresh, len(saved) == 0)
+	} else {
+		all := append(saved, fresh...)
+		sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+		err = rewriteCandles(filename, all)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to save %s candles: %v", pair, err)
+	}
+	return len(fresh), nil
+}
+
+func appendCandles(filename string, candles []Candle, header bool) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err = writeCandles(f, candles, header); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewriteCandles replaces filename with candles through a temporary file so a crash never
+// leaves a partial file behind.
+func rewriteCandles(filename string, candles []Candle) error {
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err = writeCandles(f, candles, true); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func writeCandles(w io.Writer, candles []Candle, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		cw.Write(candleColumns)
+	}
+	for _, c := range candles {
+		cw.Write([]string{
+			c.Time.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(c.Open, 'f', -1, 64), strconv.FormatFloat(c.High, 'f', -1, 64),
+			strconv.FormatFloat(c.Low, 'f', -1, 64), strconv.FormatFloat(c.Close, 'f', -1, 64),
+			strconv.FormatFloat(c.Volume, 'f', -1, 64), strconv.Itoa(c.Samples),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Candles returns the saved candles of pair for interval with from <= Time < to, see
+// MergeCandles.
+func (s *Store) Candles(pair string, interval time.Duration, from, to time.Time) ([]Candle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return readCandles(s.candleFile(pair, interval), pair, from, to)
+}
+
+func readCandles(filename, pair string, from, to time.Time) ([]Candle, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = len(candleColumns)
+	var candles []Candle
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return candles, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", filename, err)
+		}
+		if line == 1 && row[0] == candleColumns[0] {
+			continue
+		}
+
+		c := Candle{Pair: pair}
+		if c.Time, err = time.Parse(time.RFC3339, row[0]); err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid time %q", filename, line, row[0])
+		}
+		if !inRange(c.Time, from, to) {
+			continue
+		}
+		for i, v := range []*float64{&c.Open, &c.High, &c.Low, &c.Close, &c.Volume} {
+			if *v, err = strconv.ParseFloat(row[i+1], 64); err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid %s %q", filename, line, candleColumns[i+1], row[i+1])
+			}
+		}
+		if c.Samples, err = strconv.Atoi(row[6]); err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid samples %q", filename, line, row[6])
+		}
+		candles = append(candles, c)
+	}
+}
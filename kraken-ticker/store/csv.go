@@ -0,0 +1,108 @@
+package store
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+)
+
+func writeCSV(w io.Writer, records []Record, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write(columns); err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(columns))
+	for i := range records {
+		r := &records[i]
+		row[0] = r.Time.UTC().Format(time.RFC3339Nano)
+		n := 1
+		for _, d := range r.decimals() {
+			row[n] = d.String()
+			n++
+		}
+		for _, v := range r.ints() {
+			row[n] = strconv.FormatInt(*v, 10)
+			n++
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// validCSVSize returns the size of the CSV file f of size bytes without a partially
+// written final row, i.e. up to and including its last newline.
+func validCSVSize(f io.ReaderAt, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		b := buf[:end-start]
+		if _, err := f.ReadAt(b, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+func readCSV(r io.Reader, pair string, from, to time.Time) ([]Record, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// a partially written final row is ignored, it is removed before the next append
+	b = b[:bytes.LastIndexByte(b, '\n')+1]
+	cr := csv.NewReader(bytes.NewReader(b))
+	cr.FieldsPerRecord = len(columns)
+	cr.ReuseRecord = true
+
+	var records []Record
+	for line := 1; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if line == 1 && row[0] == columns[0] {
+			continue
+		}
+
+		rec := Record{Pair: pair}
+		if rec.Time, err = time.Parse(time.RFC3339Nano, row[0]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid time %q", line, row[0])
+		}
+		if !inRange(rec.Time, from, to) {
+			continue
+		}
+		n := 1
+		for _, d := range rec.decimals() {
+			if *d, err = decimal.Parse(row[n]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s %q", line, columns[n], row[n])
+			}
+			n++
+		}
+		for _, v := range rec.ints() {
+			if *v, err = strconv.ParseInt(row[n], 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s %q", line, columns[n], row[n])
+			}
+			n++
+		}
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+const indexFile = "index.json"
+
+// dayIndex describes the records in a daily file.
+type dayIndex struct {
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+	Count int       `json:"count"`
+}
+
+// index maps each day a pair has records for to the time range they cover.
+type index struct {
+	Days map[string]*dayIndex `json:"days"`
+}
+
+func readIndex(filename string) (*index, error) {
+	idx := &index{Days: make(map[string]*dayIndex)}
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return idx, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read index: %v", err)
+	}
+	if err = json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("failed to decode index %s: %v", filename, err)
+	}
+	if idx.Days == nil {
+		idx.Days = make(map[string]*dayIndex)
+	}
+	return idx, nil
+}
+
+func (idx *index) write(filename string) error {
+	b, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a truncated index
+	tmp := filename + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	return os.Rename(tmp, filename)
+}
+
+// last returns the time of the most recent record.
+func (idx *index) last() time.Time {
+	var last time.Time
+	for _, d := range idx.Days {
+		if d.Last.After(last) {
+			last = d.Last
+		}
+	}
+	return last
+}
+
+// add records that records, which are in time order, were appended to the file for day.
+func (idx *index) add(day string, records []Record) {
+	d, ok := idx.Days[day]
+	if !ok {
+		d = &dayIndex{First: records[0].Time.UTC()}
+		idx.Days[day] = d
+	}
+	d.Last = records[len(records)-1].Time.UTC()
+	d.Count += len(records)
+}
+
+// overlapping returns the days, in order, with records in [from, to).
+func (idx *index) overlapping(from, to time.Time) []string {
+	var days []string
+	for day, d := range idx.Days {
+		if (from.IsZero() || !d.Last.Before(from)) && (to.IsZero() || d.First.Before(to)) {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	return days
+}
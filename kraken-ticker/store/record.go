@@ -0,0 +1,46 @@
+// Package store persists ticker snapshots as daily, per-pair, append-only files.
+package store
+
+import (
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+)
+
+// Record is a ticker snapshot for a single pair. Prices and volumes are kept as the exact
+// decimals Kraken sent, callers needing floats convert them with Float64.
+type Record struct {
+	Time        time.Time       `json:"time"`
+	Pair        string          `json:"pair"`
+	Ask         decimal.Decimal `json:"ask"`
+	Bid         decimal.Decimal `json:"bid"`
+	Last        decimal.Decimal `json:"last"`
+	LastVolume  decimal.Decimal `json:"last_volume"`
+	VolumeToday decimal.Decimal `json:"volume_today"`
+	Volume24h   decimal.Decimal `json:"volume_24h"`
+	VWAPToday   decimal.Decimal `json:"vwap_today"`
+	VWAP24h     decimal.Decimal `json:"vwap_24h"`
+	Low24h      decimal.Decimal `json:"low_24h"`
+	High24h     decimal.Decimal `json:"high_24h"`
+	Open        decimal.Decimal `json:"open"`
+	TradesToday int64           `json:"trades_today"`
+	Trades24h   int64           `json:"trades_24h"`
+}
+
+// columns are the names of the Record fields in the order they are stored, Pair is not
+// stored as every file holds a single pair.
+var columns = []string{
+	"time", "ask", "bid", "last", "last_volume", "volume_today", "volume_24h",
+	"vwap_today", "vwap_24h", "low_24h", "high_24h", "open", "trades_today", "trades_24h",
+}
+
+func (r *Record) decimals() []*decimal.Decimal {
+	return []*decimal.Decimal{
+		&r.Ask, &r.Bid, &r.Last, &r.LastVolume, &r.VolumeToday, &r.Volume24h,
+		&r.VWAPToday, &r.VWAP24h, &r.Low24h, &r.High24h, &r.Open,
+	}
+}
+
+func (r *Record) ints() []*int64 {
+	return []*int64{&r.TradesToday, &r.Trades24h}
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+)
+
+// Candle is an OHLC bar built from the last trade price of the records in an interval.
+type Candle struct {
+	Time  time.Time `json:"time"`
+	Pair  string    `json:"pair"`
+	Open  float64   `json:"open"`
+	High  float64   `json:"high"`
+	Low   float64   `json:"low"`
+	Close float64   `json:"close"`
+	// Volume is the traded volume during the interval, derived from the change in the
+	// volume traded today between records.
+	Volume float64 `json:"volume"`
+	// Samples is the number of records in the interval, 0 for candles backfilled from
+	// Kraken's OHLC and Trades endpoints.
+	Samples int `json:"samples"`
+}
+
+// Resample groups records, which must be in time order per pair, into candles of the
+// given interval aligned to UTC midnight. Intervals without records have no candle.
+// Volumes are added up as decimals, only the candle's values are floats.
+func Resample(records []Record, interval time.Duration) []Candle {
+	type state struct {
+		volumeToday decimal.Decimal
+		seen        bool
+		// volume is the volume of the pair's open candle
+		volume decimal.Decimal
+	}
+	var candles []Candle
+	open := make(map[string]int)
+	pairs := make(map[string]*state)
+
+	for _, r := range records {
+		st, ok := pairs[r.Pair]
+		if !ok {
+			st = &state{}
+			pairs[r.Pair] = st
+		}
+
+		// today's volume resets at midnight UTC, a drop means the new value is all new volume
+		var volume decimal.Decimal
+		if st.seen {
+			if volume = r.VolumeToday.Sub(st.volumeToday); volume.Sign() < 0 {
+				volume = r.VolumeToday
+			}
+		}
+		st.volumeToday, st.seen = r.VolumeToday, true
+
+		price := r.Last.Float64()
+		start := r.Time.UTC().Truncate(interval)
+		i, ok := open[r.Pair]
+		if !ok || !candles[i].Time.Equal(start) {
+			candles = append(candles, Candle{Time: start, Pair: r.Pair, Open: price, High: price, Low: price})
+			i = len(candles) - 1
+			open[r.Pair] = i
+			st.volume = decimal.Decimal{}
+		}
+
+		c := &candles[i]
+		if price > c.High {
+			c.High = price
+		}
+		if price < c.Low {
+			c.Low = price
+		}
+		c.Close = price
+		st.volume = st.volume.Add(volume)
+		c.Volume = st.volume.Float64()
+		c.Samples++
+	}
+	return candles
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Days returns the days, as yyyy-mm-dd, pair has records for in order.
+func (s *Store) Days(pair string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, err := s.loadIndex(pair)
+	if err != nil {
+		return nil, err
+	}
+	days := make([]string, 0, len(idx.Days))
+	for day := range idx.Days {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// RemoveDay deletes the daily files of pair for day, in every format, and removes the day
+// from the index. Removing the most recent day lets records at or before its last time be
+// appended again.
+func (s *Store) RemoveDay(pair, day string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, err := s.loadIndex(pair)
+	if err != nil {
+		return err
+	}
+
+	for _, format := range []Format{CSV, Binary} {
+		for _, suffix := range []string{"", ".gz"} {
+			err := os.Remove(filepath.Join(s.pairDir(pair), day+format.ext()+suffix))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s %s: %v", pair, day, err)
+			}
+		}
+	}
+	if _, ok := idx.Days[day]; !ok {
+		return nil
+	}
+	delete(idx.Days, day)
+	return idx.write(filepath.Join(s.pairDir(pair), indexFile))
+}
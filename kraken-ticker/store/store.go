@@ -0,0 +1,293 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Format is the encoding of the daily record files.
+type Format string
+
+const (
+	// CSV stores records as comma separated text with a header row.
+	CSV Format = "csv"
+	// Binary stores records as fixed size little endian rows, see binaryRecordSize.
+	Binary Format = "binary"
+)
+
+func (f Format) ext() string {
+	if f == Binary {
+		return ".bin"
+	}
+	return ".csv"
+}
+
+// ParseFormat parses "csv" or "binary".
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case CSV, Binary:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown store format %q, expected csv or binary", s)
+}
+
+// dayLayout names the daily files, e.g. 2023-07-06.csv.
+const dayLayout = "2006-01-02"
+
+// Store appends records to <dir>/<pair>/<day><ext> files, keeping an index of the time
+// range covered by each file in <dir>/<pair>/index.json. Records must be appended in
+// time order per pair, records at or before the last stored time are skipped.
+type Store struct {
+	dir    string
+	format Format
+	log    *zap.SugaredLogger
+
+	mu      sync.Mutex
+	indexes map[string]*index
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithLogger logs repairs made to damaged files, e.g. a partially written final row
+// removed before appending, which are otherwise made silently.
+func WithLogger(log *zap.SugaredLogger) Option {
+	return func(s *Store) { s.log = log }
+}
+
+// Open opens the store in dir, creating dir if needed.
+func Open(dir string, format Format, opts ...Option) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %v", err)
+	}
+	s := &Store{dir: dir, format: format, log: zap.NewNop().Sugar(), indexes: make(map[string]*index)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Dir returns the directory the store was opened in.
+func (s *Store) Dir() string { return s.dir }
+
+func (s *Store) pairDir(pair string) string { return filepath.Join(s.dir, pair) }
+
+// loadIndex returns the index for pair, reading it from disk on first use. Callers must
+// hold s.mu.
+func (s *Store) loadIndex(pair string) (*index, error) {
+	if idx, ok := s.indexes[pair]; ok {
+		return idx, nil
+	}
+	idx, err := readIndex(filepath.Join(s.pairDir(pair), indexFile))
+	if err != nil {
+		return nil, err
+	}
+	s.indexes[pair] = idx
+	return idx, nil
+}
+
+// Append stores records, grouping them into per-pair daily files.
+func (s *Store) Append(records ...Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type key struct{ pair, day string }
+	groups := make(map[key][]Record)
+	var keys []key
+	for _, r := range records {
+		if r.Pair == "" || strings.ContainsAny(r.Pair, `/\`) || strings.HasPrefix(r.Pair, ".") {
+			return fmt.Errorf("invalid pair name %q", r.Pair)
+		}
+		k := key{r.Pair, r.Time.UTC().Format(dayLayout)}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], r)
+	}
+
+	for _, k := range keys {
+		idx, err := s.loadIndex(k.pair)
+		if err != nil {
+			return err
+		}
+
+		group := groups[k]
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Time.Before(group[j].Time) })
+		last := idx.last()
+		var fresh []Record
+		for _, r := range group {
+			if r.Time.After(last) {
+				fresh = append(fresh, r)
+				last = r.Time
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+
+		if err = os.MkdirAll(s.pairDir(k.pair), 0755); err != nil {
+			return fmt.Errorf("failed to create pair directory: %v", err)
+		}
+		if err = s.appendFile(filepath.Join(s.pairDir(k.pair), k.day+s.format.ext()), fresh); err != nil {
+			return fmt.Errorf("failed to append %s records: %v", k.pair, err)
+		}
+		idx.add(k.day, fresh)
+		if err = idx.write(filepath.Join(s.pairDir(k.pair), indexFile)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) appendFile(filename string, records []Record) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	// a crash while appending leaves a partially written final row, which would misalign
+	// every binary row appended after it and join the next CSV row onto it
+	size := fi.Size()
+	var valid int64
+	if s.format == Binary {
+		valid = validBinarySize(size)
+	} else if valid, err = validCSVSize(f, size); err != nil {
+		f.Close()
+		return err
+	}
+	if valid != size {
+		if err = f.Truncate(valid); err != nil {
+			f.Close()
+			return err
+		}
+		s.log.Warnf("truncated %s from %d to %d bytes to remove a partially written row", filename, size, valid)
+		size = valid
+	}
+	if _, err = f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	if s.format == Binary {
+		err = writeBinary(f, records, size == 0)
+	} else {
+		err = writeCSV(f, records, size == 0)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Pairs returns the pairs with stored records.
+func (s *Store) Pairs() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(s.dir, e.Name(), indexFile)); err == nil {
+			pairs = append(pairs, e.Name())
+		}
+	}
+	return pairs, nil
+}
+
+// Query returns the records for pair with from <= Time < to in time order. A zero from or
+// to leaves that end of the range open.
+func (s *Store) Query(pair string, from, to time.Time) ([]Record, error) {
+	s.mu.Lock()
+	idx, err := s.loadIndex(pair)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	days := idx.overlapping(from, to)
+	s.mu.Unlock()
+
+	var records []Record
+	for _, day := range days {
+		rs, err := s.readDay(pair, day, from, to)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rs...)
+	}
+	return records, nil
+}
+
+// readDay reads the records for day. Files in either format are read, as is a gzip
+// compressed copy of each, so changing -format or compressing old days by hand does not
+// hide any records.
+func (s *Store) readDay(pair, day string, from, to time.Time) ([]Record, error) {
+	var records []Record
+	for _, format := range []Format{CSV, Binary} {
+		for _, suffix := range []string{"", ".gz"} {
+			rs, err := readDayFile(filepath.Join(s.pairDir(pair), day+format.ext()+suffix), format, pair, from, to)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, rs...)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+func readDayFile(filename string, format Format, pair string, from, to time.Time) ([]Record, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.ReadSeeker = f
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", filename, err)
+		}
+		b, err := io.ReadAll(gz)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", filename, err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	var records []Record
+	if format == Binary {
+		records, err = readBinary(r, pair, from, to)
+	} else {
+		records, err = readCSV(r, pair, from, to)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", filename, err)
+	}
+	return records, nil
+}
+
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/decimal"
+)
+
+var start = time.Date(2024, 1, 1, 23, 58, 0, 0, time.UTC)
+
+// testRecords returns n records a minute apart from start, crossing into the next day
+// after the second, with prices and volumes at different scales.
+func testRecords(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{
+			Time:        start.Add(time.Duration(i) * time.Minute),
+			Pair:        "XXBTZUSD",
+			Ask:         decimal.New(3000010000+int64(i), 5),
+			Bid:         decimal.Must("0.000000012345"),
+			Last:        decimal.Must("30000.1"),
+			LastVolume:  decimal.Must("0.00100000"),
+			VolumeToday: decimal.Must("123456789.12345678"),
+			Volume24h:   decimal.Must("-1.5"),
+			Open:        decimal.Must("29000"),
+			TradesToday: int64(i),
+			Trades24h:   1 << 40,
+		}
+	}
+	return records
+}
+
+// format prints records with each decimal as its string, so scales are compared too.
+func format(records []Record) string {
+	var b bytes.Buffer
+	for _, r := range records {
+		fmt.Fprintf(&b, "%+v\n", r)
+	}
+	return b.String()
+}
+
+func query(t *testing.T, s *Store, from, to time.Time) []Record {
+	t.Helper()
+	records, err := s.Query("XXBTZUSD", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func checkRecords(t *testing.T, got, want []Record) {
+	t.Helper()
+	if format(got) != format(want) {
+		t.Errorf("got records\n%s\nwant\n%s", format(got), format(want))
+	}
+}
+
+func forEachFormat(t *testing.T, fn func(t *testing.T, format Format)) {
+	for _, format := range []Format{CSV, Binary} {
+		format := format
+		t.Run(string(format), func(t *testing.T) { fn(t, format) })
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	forEachFormat(t, func(t *testing.T, format Format) {
+		dir := t.TempDir()
+		s, err := Open(dir, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := testRecords(4)
+		if err = s.Append(records...); err != nil {
+			t.Fatal(err)
+		}
+		checkRecords(t, query(t, s, time.Time{}, time.Time{}), records)
+		// the range crosses midnight, from is inclusive and to exclusive
+		checkRecords(t, query(t, s, records[1].Time, records[3].Time), records[1:3])
+		checkRecords(t, query(t, s, records[3].Time.Add(time.Nanosecond), time.Time{}), nil)
+
+		// a reopened store reads the same records through the saved index
+		if s, err = Open(dir, format); err != nil {
+			t.Fatal(err)
+		}
+		checkRecords(t, query(t, s, time.Time{}, time.Time{}), records)
+		if pairs, err := s.Pairs(); err != nil || len(pairs) != 1 || pairs[0] != "XXBTZUSD" {
+			t.Errorf("got pairs %v, %v", pairs, err)
+		}
+	})
+}
+
+func TestAppendSkipsStoredTimes(t *testing.T) {
+	forEachFormat(t, func(t *testing.T, format Format) {
+		dir := t.TempDir()
+		s, err := Open(dir, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := testRecords(6)
+		if err = s.Append(records[0], records[1]); err != nil {
+			t.Fatal(err)
+		}
+		// records out of order within a call are sorted, duplicates and records at or
+		// before the last stored time are skipped
+		dup := records[1]
+		dup.Last = decimal.Must("1")
+		if err = s.Append(records[3], dup, records[0], records[2], records[3]); err != nil {
+			t.Fatal(err)
+		}
+		checkRecords(t, query(t, s, time.Time{}, time.Time{}), records[:4])
+
+		// the last stored time survives reopening the store
+		if s, err = Open(dir, format); err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Append(records[2], records[4]); err != nil {
+			t.Fatal(err)
+		}
+		checkRecords(t, query(t, s, time.Time{}, time.Time{}), records[:5])
+	})
+}
+
+func TestAppendAfterTornRow(t *testing.T) {
+	forEachFormat(t, func(t *testing.T, format Format) {
+		dir := t.TempDir()
+		s, err := Open(dir, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := testRecords(2)
+		if err = s.Append(records[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		// a crash while appending the second record leaves half of its row
+		var row bytes.Buffer
+		if format == Binary {
+			err = writeBinary(&row, records[1:], false)
+		} else {
+			err = writeCSV(&row, records[1:], false)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(dir, "XXBTZUSD", "2024-01-01"+format.ext())
+		f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(row.Bytes()[:row.Len()/2])
+		f.Close()
+
+		if s, err = Open(dir, format); err != nil {
+			t.Fatal(err)
+		}
+		checkRecords(t, query(t, s, time.Time{}, time.Time{}), records[:1])
+		if err = s.Append(records[1]); err != nil {
+			t.Fatal(err)
+		}
+		checkRecords(t, query(t, s, time.Time{}, time.Time{}), records)
+	})
+}
+
+func TestBinaryDecimal(t *testing.T) {
+	for _, tt := range []struct {
+		in    string
+		coef  int64
+		scale byte
+		err   bool
+	}{
+		{in: "0", coef: 0, scale: 0},
+		{in: "30000.10000", coef: 3000010000, scale: 5},
+		{in: "-0.000000012345", coef: -12345, scale: 12},
+		{in: "9223372036854775807", coef: 9223372036854775807, scale: 0},
+		// digits after the decimal point are rounded away until the coefficient fits
+		{in: "123456789012345678.126", coef: 1234567890123456781, scale: 1},
+		{in: "0." + string(bytes.Repeat([]byte("1"), 300)), coef: 1111111111111111111, scale: 19},
+		{in: "9223372036854775808", err: true},
+	} {
+		coef, scale, err := binaryDecimal(decimal.Must(tt.in))
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: got %d %d, want an error", tt.in, coef, scale)
+			}
+			continue
+		}
+		if err != nil || coef != tt.coef || scale != tt.scale {
+			t.Errorf("%s: got %d %d %v, want %d %d", tt.in, coef, scale, err, tt.coef, tt.scale)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/alert"
+	"github.com/1gm/x/kraken-ticker/exchange"
+	"github.com/1gm/x/kraken-ticker/kraken/ws"
+	"github.com/1gm/x/kraken-ticker/orderbook"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+// streamer saves the WebSocket ticker feed, a record is stored for every ticker update.
+// Trades and the book keep the last trade volume and best bid and ask current between
+// ticker updates, which Kraken only sends after trades.
+type streamer struct {
+	log   *zap.SugaredLogger
+	store *store.Store
+	gaps  *gapTracker
+	// alerts is nil when no alert rules are configured.
+	alerts *alert.Engine
+	// books is nil unless order books are saved.
+	books *orderbook.Store
+	// metrics is nil unless -metrics is set.
+	metrics     *exporter
+	housekeeper *housekeeper
+	// portfolio is nil unless -holdings is set.
+	portfolio *valuer
+	// pairs maps WebSocket symbols, e.g. BTC/USD, to the pair keys used by the store.
+	pairs map[string]string
+
+	mu      sync.Mutex
+	latest  map[string]*store.Record
+	book    map[string]orderbook.Snapshot
+	pending []store.Record
+	saved   int
+}
+
+func newStreamer(log *zap.SugaredLogger, st *store.Store, gaps *gapTracker, alerts *alert.Engine, books *orderbook.Store, metrics *exporter, house *housekeeper, portfolio *valuer, pairs map[string]string) *streamer {
+	return &streamer{
+		log:         log,
+		store:       st,
+		gaps:        gaps,
+		alerts:      alerts,
+		books:       books,
+		metrics:     metrics,
+		housekeeper: house,
+		portfolio:   portfolio,
+		pairs:       pairs,
+		latest:      make(map[string]*store.Record),
+		book:        make(map[string]orderbook.Snapshot),
+	}
+}
+
+// run streams until ctx is done, flushing records to the store every second. Trades are
+// streamed from ex, the ticker and book channels from client. Progress is logged, order
+// books are saved and holdings are valued every interval.
+func (s *streamer) run(ctx context.Context, client *ws.Client, ex exchange.Exchange, channels []string, precision map[string]ws.Precision, interval time.Duration) error {
+	symbols := make([]string, 0, len(s.pairs))
+	keys := make([]string, 0, len(s.pairs))
+	for symbol, key := range s.pairs {
+		symbols = append(symbols, symbol)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var (
+		subs   []ws.Subscription
+		trades bool
+	)
+	for _, ch := range channels {
+		if ch == ws.ChannelTrade {
+			trades = true
+			continue
+		}
+		subs = append(subs, ws.Subscription{Channel: ch, Symbols: symbols, Precision: precision})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// streams are the number of streams sending their result to errc
+	errc := make(chan error, 2)
+	streams := 0
+	if len(subs) > 0 {
+		streams++
+		go func() {
+			errc <- client.Run(ctx, subs, ws.Handler{
+				Ticker: s.onTicker,
+				Book:   s.onBook,
+				Gap:    s.onGap,
+				Error:  s.onDisconnect,
+			})
+		}()
+	}
+	if trades {
+		streams++
+		go func() { errc <- ex.StreamTrades(ctx, keys, s.onTrade) }()
+	}
+	// stop ends every stream and returns the first error
+	stop := func(err error) error {
+		cancel()
+		for ; streams > 0; streams-- {
+			if streamErr := <-errc; err == nil && !errors.Is(streamErr, context.Canceled) {
+				err = streamErr
+			}
+		}
+		return err
+	}
+
+	flush := time.NewTicker(time.Second)
+	defer flush.Stop()
+	progress := time.NewTicker(interval)
+	defer progress.Stop()
+	for {
+		select {
+		case <-flush.C:
+			if err := s.flush(); err != nil {
+				return stop(err)
+			}
+		case <-progress.C:
+			s.mu.Lock()
+			s.log.Infof("saved %d records in the last %s", s.saved, interval)
+			s.saved = 0
+			s.mu.Unlock()
+			err := s.saveBooks()
+			if err == nil {
+				err = s.portfolio.save(time.Now())
+			}
+			if err != nil {
+				return stop(err)
+			}
+			s.housekeeper.run(time.Now())
+		case err := <-errc:
+			streams--
+			if errors.Is(err, context.Canceled) {
+				err = nil
+			}
+			err = stop(err)
+			if flushErr := s.flush(); flushErr != nil {
+				return flushErr
+			}
+			return err
+		}
+	}
+}
+
+func (s *streamer) flush() error {
+	s.mu.Lock()
+	records := s.pending
+	s.pending = nil
+	s.saved += len(records)
+	s.mu.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.store.Append(records...); err != nil {
+		return err
+	}
+	s.metrics.observe(records...)
+	s.metrics.succeeded(time.Now())
+	s.portfolio.observe(records...)
+	if s.alerts != nil {
+		s.alerts.Evaluate(records...)
+	}
+	return nil
+}
+
+// record returns the latest state of the pair for symbol, callers must hold s.mu.
+func (s *streamer) record(symbol string) *store.Record {
+	pair, ok := s.pairs[symbol]
+	if !ok {
+		return nil
+	}
+	return s.pairRecord(pair)
+}
+
+// pairRecord returns the latest state of pair, given by key, callers must hold s.mu.
+func (s *streamer) pairRecord(pair string) *store.Record {
+	r, ok := s.latest[pair]
+	if !ok {
+		r = &store.Record{Pair: pair}
+		s.latest[pair] = r
+	}
+	return r
+}
+
+func (s *streamer) onTicker(t ws.Ticker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.record(t.Symbol)
+	if r == nil {
+		return
+	}
+	r.Time = time.Now().UTC()
+	r.Ask, r.Bid, r.Last = t.Ask, t.Bid, t.Last
+	r.Volume24h, r.VWAP24h = t.Volume, t.VWAP
+	r.Low24h, r.High24h = t.Low, t.High
+	// the WebSocket ticker has no opening price, only the change over 24 hours
+	r.Open = t.Last.Sub(t.Change)
+	s.pending = append(s.pending, *r)
+}
+
+func (s *streamer) onTrade(t exchange.Trade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.Pair == "" {
+		return
+	}
+	r := s.pairRecord(t.Pair)
+	r.Last, r.LastVolume = t.Price, t.Volume
+}
+
+// saveBooks saves the latest order book of each pair.
+func (s *streamer) saveBooks() error {
+	if s.books == nil {
+		return nil
+	}
+	s.mu.Lock()
+	snapshots := make([]orderbook.Snapshot, 0, len(s.book))
+	for _, snap := range s.book {
+		snapshots = append(snapshots, snap)
+	}
+	s.mu.Unlock()
+
+	metrics, err := s.books.Append(snapshots...)
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		logBookMetrics(s.log, m)
+	}
+	return nil
+}
+
+func (s *streamer) onBook(b *ws.Book) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.record(b.Symbol)
+	if r == nil {
+		return
+	}
+	if s.books != nil {
+		s.book[r.Pair] = orderbook.FromStream(time.Now(), r.Pair, b)
+	}
+	if len(b.Asks) > 0 {
+		r.Ask = b.Asks[0].Price
+	}
+	if len(b.Bids) > 0 {
+		r.Bid = b.Bids[0].Price
+	}
+}
+
+func (s *streamer) onDisconnect(err error) {
+	s.log.Warn("stream disconnected, reconnecting: ", err)
+	s.metrics.disconnected()
+}
+
+func (s *streamer) onGap(g ws.Gap) {
+	gp := gap{From: g.From, To: g.To, Missed: int(g.Missed), Reason: g.Reason}
+	if g.Symbol != "" {
+		gp.Pair = s.pairs[g.Symbol]
+		s.log.Warnf("%s: %s", gp.Pair, g.Reason)
+	} else {
+		s.log.Warnf("stream recovered after %s", g.To.Sub(g.From).Round(time.Second))
+	}
+	if err := s.gaps.record(gp); err != nil {
+		s.log.Error("failed to record gap: ", err)
+	}
+	s.metrics.gap()
+}
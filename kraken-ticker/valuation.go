@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/1gm/x/kraken-ticker/exchange"
+	"github.com/1gm/x/kraken-ticker/portfolio"
+	"github.com/1gm/x/kraken-ticker/store"
+	"go.uber.org/zap"
+)
+
+// valuer values the holdings from -holdings after every poll, or every interval when
+// streaming, and saves each valuation to <-o>/portfolio. Its methods do nothing on a nil
+// valuer so callers do not need to check whether -holdings is set.
+type valuer struct {
+	log    *zap.SugaredLogger
+	valuer *portfolio.Valuer
+	store  *portfolio.Store
+}
+
+// loadValuer reads the holdings file and finds the pairs needed to value every holding in
+// -currency.
+func loadValuer(ctx context.Context, log *zap.SugaredLogger, opts options, ex exchange.Exchange) (*valuer, error) {
+	holdings, err := portfolio.LoadHoldings(opts.holdings)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []exchange.Pair
+	err = retry(ctx, opts.retries, startupBackoff, func(ctx context.Context) (err error) {
+		pairs, err = ex.Pairs(ctx)
+		return err
+	}, func(attempt int, delay time.Duration, err error) {
+		log.Warnf("failed to list pairs, retry %d/%d in %s: %v", attempt, opts.retries, delay.Round(time.Millisecond), err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	v, err := portfolio.NewValuer(pairs, holdings, opts.currency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid holdings: %v", err)
+	}
+
+	st, err := portfolio.OpenStore(filepath.Join(opts.directory, "portfolio"))
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range holdings {
+		if path := v.Path(h.Asset); strings.Count(path, "/") > 1 {
+			log.Infof("valuing %s through %s", h.Asset, path)
+		}
+	}
+	log.Infof("loaded %d holdings valued in %s", len(holdings), v.Currency())
+	return &valuer{log: log, valuer: v, store: st}, nil
+}
+
+// pairs returns the pairs whose prices are needed, nil on a nil valuer.
+func (v *valuer) pairs() []string {
+	if v == nil {
+		return nil
+	}
+	return v.valuer.Pairs()
+}
+
+// observe keeps the latest prices in records.
+func (v *valuer) observe(records ...store.Record) {
+	if v == nil {
+		return
+	}
+	v.valuer.Update(records...)
+}
+
+// save values the holdings at the latest prices and saves the valuation stamped at t.
+func (v *valuer) save(t time.Time) error {
+	if v == nil {
+		return nil
+	}
+	val := v.valuer.Value(t.UTC().Truncate(time.Second))
+	if len(val.Missing) > 0 {
+		v.log.Warnf("no price yet to value %s", strings.Join(val.Missing, ", "))
+		if len(val.Assets) == 0 {
+			return nil
+		}
+	}
+	if err := v.store.Append(val); err != nil {
+		return err
+	}
+	v.log.Infof("portfolio value=%.2f %s cost=%.2f unrealized pnl=%+.2f (%+.2f%%)",
+		val.Total.Value, val.Currency, val.Total.CostBasis, val.Total.PnL, val.Total.PnLPercent)
+	return nil
+}